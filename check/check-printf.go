@@ -0,0 +1,97 @@
+package check
+
+import (
+	"strings"
+	"text/template/parse"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+// isPrintf tells if fn formats its arguments as fmt.Sprintf does,
+// such as the printf builtin.
+func isPrintf(fn export.Func) bool {
+	return fn.Pkg == "fmt" && (fn.Sel == "fmt.Sprintf" || fn.Sel == "fmt.Errorf")
+}
+
+// printf checks the arguments of a printf call against the verbs
+// of its constant format, the first argument.
+// Formats using explicit argument indexes or * are not checked.
+func (w *walker) printf(name string, pos parse.Pos, args []arg) {
+	if len(args) == 0 || !args[0].v.IsConst {
+		return
+	}
+	format := args[0].v.Const
+	argNum := 1
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		// flags, width and precision.
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			return
+		}
+		verb := format[i]
+		switch verb {
+		case '%':
+			continue
+		case '*', '[':
+			return
+		}
+		if argNum >= len(args) {
+			w.reportAt(name, pos, "format %%%c of %q reads arg #%v, but call has %v args", verb, name, argNum, len(args)-1)
+			return
+		}
+		a := args[argNum]
+		argNum++
+		if verbAccepts(verb, a.v) {
+			continue
+		}
+		at := pos
+		if a.node != nil {
+			at = a.node.Position()
+		}
+		w.reportAt(name, at, "format %%%c of %q has arg #%v of wrong type %v", verb, name, argNum-1, a.v)
+	}
+}
+
+// verbAccepts tells if a printf verb formats v.
+func verbAccepts(verb byte, v value) bool {
+	if verb == 'v' || verb == 'T' || v.Type == "" || v.Kind == "" {
+		return true
+	}
+	// a named type may implement fmt.Stringer or error.
+	if strings.Contains(v.Type, ".") && strings.IndexByte("sqv", verb) >= 0 {
+		return true
+	}
+	var verbs string
+	switch kind := v.Kind; {
+	case kind == "interface", kind == "map", kind == "array", kind == "struct":
+		// the verb applies to the dynamic value or to the elements.
+		return true
+	case kind == "slice":
+		if v.Type == "[]byte" || v.Type == "[]uint8" {
+			verbs = "sqxX"
+		} else {
+			return true
+		}
+	case kind == "string":
+		verbs = "sqxX"
+	case kind == "bool":
+		verbs = "t"
+	case isInteger(kind):
+		verbs = "bcdoOqxXU"
+	case isFloat(kind), isComplex(kind):
+		verbs = "beEfFgGxX"
+	case kind == "ptr":
+		verbs = "pbdoOxX"
+	case kind == "chan", kind == "func":
+		verbs = "p"
+	case kind == "nil":
+		return true
+	}
+	return strings.IndexByte(verbs, verb) >= 0
+}
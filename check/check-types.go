@@ -0,0 +1,220 @@
+package check
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+// DataType returns the type of name, such as github.com/acme/app/views.PageData
+// or *github.com/acme/app/views.PageData, its package is loaded into prog.
+func DataType(prog *export.Program, name string) (types.Type, error) {
+	typeName := strings.TrimPrefix(name, "*")
+	dot := strings.LastIndex(typeName, ".")
+	if dot < strings.LastIndex(typeName, "/") || dot < 1 {
+		return nil, fmt.Errorf("Invalid data type %v, want pkgpath.Type", name)
+	}
+	pkgPath := typeName[:dot]
+	pkg, err := prog.LoadPackage(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Types.Scope().Lookup(typeName[dot+1:]).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("type %v not found in %v", typeName[dot+1:], pkgPath)
+	}
+	if strings.HasPrefix(name, "*") {
+		return types.NewPointer(obj.Type()), nil
+	}
+	return obj.Type(), nil
+}
+
+// value is the value of a template expression,
+// its Type is empty when it is not known.
+type value struct {
+	// Type and Kind are as described by export.Param.
+	Type string
+	Kind string
+	// Untyped tells the value is a constant of the template,
+	// such as "a" or 1, its Kind tells the values it converts to.
+	Untyped bool
+	// Const is the text of a string constant.
+	Const   string
+	IsConst bool
+	// t is the type of the value, when it comes from the data.
+	t types.Type
+}
+
+// typedValue returns a value of type t.
+func typedValue(t types.Type) value {
+	p := export.DescribeType(t)
+	return value{Type: p.Type, Kind: p.Kind, t: t}
+}
+
+// deref returns the type pointed to by t, or t.
+func deref(t types.Type) types.Type {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return t
+}
+
+func (v value) String() string {
+	if v.Kind == "nil" {
+		return "nil"
+	}
+	if v.Untyped {
+		return "untyped " + v.Kind
+	}
+	return v.Type
+}
+
+// typed returns the value a constant takes once stored in a variable.
+func (v value) typed() value {
+	if v.Kind == "nil" {
+		return value{}
+	}
+	v.Untyped = false
+	return v
+}
+
+// result returns the value of the result of fn,
+// a function of a funcmap returns one value, or one value and an error.
+func result(fn export.Func) (value, bool) {
+	switch {
+	case len(fn.Results) == 1:
+	case len(fn.Results) == 2 && fn.Results[1].Type == "error":
+	default:
+		return value{}, false
+	}
+	r := fn.Results[0]
+	return value{Type: r.Type, Kind: r.Kind}, true
+}
+
+// assignable tells if v can be passed to a parameter of type want,
+// the way text/template converts its arguments.
+// Values whose types are not fully known are assignable.
+func assignable(v value, want, kind string) bool {
+	if v.Type == "" || want == "" || kind == "" || kind == "interface" {
+		return true
+	}
+	if v.Untyped {
+		switch v.Kind {
+		case "string", "bool":
+			return kind == v.Kind
+		case "int":
+			return isInteger(kind) || isFloat(kind) || isComplex(kind)
+		case "float64":
+			return isFloat(kind) || isComplex(kind)
+		case "complex128":
+			return isComplex(kind)
+		case "nil":
+			return kind == "ptr" || kind == "slice" || kind == "map" || kind == "chan" || kind == "func"
+		}
+		return true
+	}
+	if v.Type == want || v.Kind == "" || v.Kind == "interface" {
+		return true
+	}
+	// the template dereferences pointers, and takes the address of values.
+	return v.Type == "*"+want || want == "*"+v.Type
+}
+
+// rangeOf returns the key and element values of a range over v.
+func rangeOf(v value) (key, elem value) {
+	if v.t != nil {
+		return rangeOfType(v.t)
+	}
+	t := v.Type
+	switch {
+	case strings.HasPrefix(t, "[]"):
+		return value{Type: "int", Kind: "int"}, typeValue(t[2:])
+	case strings.HasPrefix(t, "map["):
+		// map[K]V, K may contain brackets.
+		depth := 0
+		for i := len("map"); i < len(t); i++ {
+			switch t[i] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+				if depth == 0 {
+					return typeValue(t[len("map["):i]), typeValue(t[i+1:])
+				}
+			}
+		}
+	case strings.HasPrefix(t, "chan "):
+		return value{}, typeValue(t[len("chan "):])
+	case strings.HasPrefix(t, "<-chan "):
+		return value{}, typeValue(t[len("<-chan "):])
+	case isInteger(v.Kind) && !strings.Contains(t, "."):
+		return value{}, value{Type: t, Kind: v.Kind}
+	}
+	return value{}, value{}
+}
+
+// rangeOfType returns the key and element values of a range over t.
+func rangeOfType(t types.Type) (key, elem value) {
+	intValue := typedValue(types.Typ[types.Int])
+	switch u := deref(t).Underlying().(type) {
+	case *types.Slice:
+		return intValue, typedValue(u.Elem())
+	case *types.Array:
+		return intValue, typedValue(u.Elem())
+	case *types.Map:
+		return typedValue(u.Key()), typedValue(u.Elem())
+	case *types.Chan:
+		return value{}, typedValue(u.Elem())
+	case *types.Basic:
+		if u.Info()&types.IsInteger != 0 {
+			return value{}, typedValue(t)
+		}
+	case *types.Signature:
+		// iter.Seq and iter.Seq2, func(yield func(K, V) bool).
+		if u.Params().Len() == 1 {
+			if yield, ok := u.Params().At(0).Type().Underlying().(*types.Signature); ok {
+				switch yield.Params().Len() {
+				case 1:
+					return value{}, typedValue(yield.Params().At(0).Type())
+				case 2:
+					return typedValue(yield.Params().At(0).Type()), typedValue(yield.Params().At(1).Type())
+				}
+			}
+		}
+	}
+	return value{}, value{}
+}
+
+// typeValue returns a value of type t,
+// its kind is known for the basic and pointer types only.
+func typeValue(t string) value {
+	switch {
+	case basicKinds[t]:
+		return value{Type: t, Kind: t}
+	case strings.HasPrefix(t, "*"):
+		return value{Type: t, Kind: "ptr"}
+	}
+	return value{Type: t}
+}
+
+var basicKinds = map[string]bool{
+	"bool": true, "string": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+	"byte": true, "rune": true,
+}
+
+func isInteger(kind string) bool {
+	return strings.HasPrefix(kind, "int") || strings.HasPrefix(kind, "uint") || kind == "byte" || kind == "rune"
+}
+
+func isFloat(kind string) bool {
+	return strings.HasPrefix(kind, "float")
+}
+
+func isComplex(kind string) bool {
+	return strings.HasPrefix(kind, "complex")
+}
@@ -0,0 +1,113 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+// Usage reports the functions of the funcmaps used by templates,
+// it serializes to JSON.
+type Usage struct {
+	// Used lists the functions called by the templates, by name.
+	Used []FuncUsage `json:"used"`
+	// Unused lists the functions never called, by name.
+	Unused []FuncUsage `json:"unused"`
+}
+
+// FuncUsage is a function of a funcmap along with its calls.
+type FuncUsage struct {
+	Name string `json:"name"`
+	// Funcmap is the variable the function belongs to, as pkgpath:var.
+	Funcmap string `json:"funcmap"`
+	// Calls are the positions of the calls of the function.
+	Calls []export.Position `json:"calls"`
+}
+
+// Usage reports the functions of Funcs that the templates of paths
+// call or not, paths are as given to CheckFiles.
+// The templates must parse, their problems are not reported.
+func (c *Checker) Usage(paths ...string) (*Usage, error) {
+	calls := map[string][]export.Position{}
+	err := eachFile(paths, func(file, text string) error {
+		w, err := c.check(file, text)
+		if err != nil {
+			return err
+		}
+		for name, positions := range w.calls {
+			calls[name] = append(calls[name], positions...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range c.Funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	u := &Usage{Used: []FuncUsage{}, Unused: []FuncUsage{}}
+	for _, name := range names {
+		f := FuncUsage{Name: name, Funcmap: c.Funcs[name].Funcmap, Calls: calls[name]}
+		if len(f.Calls) == 0 {
+			f.Calls = []export.Position{}
+			u.Unused = append(u.Unused, f)
+			continue
+		}
+		sort.SliceStable(f.Calls, func(i, j int) bool {
+			a, b := f.Calls[i], f.Calls[j]
+			if a.Filename != b.Filename {
+				return a.Filename < b.Filename
+			}
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		u.Used = append(u.Used, f)
+	}
+	return u, nil
+}
+
+// Filter removes the functions of the funcmap of given pkgpath:var
+// from the report, such as text/template:builtins.
+func (u *Usage) Filter(funcmap string) {
+	filter := func(funcs []FuncUsage) []FuncUsage {
+		ret := []FuncUsage{}
+		for _, f := range funcs {
+			if f.Funcmap != funcmap {
+				ret = append(ret, f)
+			}
+		}
+		return ret
+	}
+	u.Used = filter(u.Used)
+	u.Unused = filter(u.Unused)
+}
+
+// WriteText writes the report as text, one line per unused function,
+// then one line per used function followed by its calls, such as
+//
+//	unused	trim	github.com/acme/app/views:funcs
+//	used	upper	github.com/acme/app/views:funcs
+//		views/index.tmpl:3:12
+func (u *Usage) WriteText(w io.Writer) error {
+	for _, f := range u.Unused {
+		if _, err := fmt.Fprintf(w, "unused\t%v\t%v\n", f.Name, f.Funcmap); err != nil {
+			return err
+		}
+	}
+	for _, f := range u.Used {
+		if _, err := fmt.Fprintf(w, "used\t%v\t%v\n", f.Name, f.Funcmap); err != nil {
+			return err
+		}
+		for _, pos := range f.Calls {
+			if _, err := fmt.Fprintf(w, "\t%v\n", pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
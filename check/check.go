@@ -0,0 +1,548 @@
+// Package check checks the function calls of go templates
+// against the symbolic version of their funcmaps.
+package check
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+// Extensions are the extensions of the template files found in directories.
+var Extensions = []string{".tmpl", ".html"}
+
+// Problem is a function call or a field of a template that would fail.
+type Problem struct {
+	Pos export.Position `json:"pos"`
+	// Func is the name of the called function or method,
+	// it is empty for the problems of fields.
+	Func string `json:"func"`
+	Msg  string `json:"msg"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: %v", p.Pos, p.Msg)
+}
+
+// Checker checks templates against the functions they can call.
+type Checker struct {
+	// Funcs are the functions of the funcmaps, by name.
+	Funcs map[string]export.Func
+	// LeftDelim and RightDelim are the action delimiters,
+	// {{ and }} when empty.
+	LeftDelim  string
+	RightDelim string
+	// Data is the type of the data the templates are executed with,
+	// the fields and methods of the dot are checked when it is set.
+	Data types.Type
+}
+
+// New returns a checker of the functions of desc.
+// A function is found in desc when the targets describe its funcmap,
+// such as @text/template for the builtin functions.
+func New(desc *export.Description) *Checker {
+	c := &Checker{Funcs: map[string]export.Func{}}
+	for _, fn := range desc.Funcs {
+		c.Funcs[fn.Name] = fn
+	}
+	return c
+}
+
+// CheckFiles checks the templates of paths,
+// the directories are walked for the files of Extensions,
+// the glob patterns are expanded.
+func (c *Checker) CheckFiles(paths ...string) ([]Problem, error) {
+	var problems []Problem
+	err := eachFile(paths, func(file, text string) error {
+		p, err := c.Check(file, text)
+		problems = append(problems, p...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// eachFile calls fn with the content of the template files of paths.
+func eachFile(paths []string, fn func(file, text string) error) error {
+	for _, path := range paths {
+		files, err := templateFiles(path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := fn(file, string(b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// templateFiles returns the files of path, a file, a directory
+// walked for the files of Extensions, or a glob pattern.
+func templateFiles(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no template files match %v", path)
+		}
+		var files []string
+		for _, m := range matches {
+			f, err := templateFiles(m)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f...)
+		}
+		return files, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(p)
+		for _, e := range Extensions {
+			if !d.IsDir() && ext == e {
+				files = append(files, p)
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Check checks the template text, name is the filename reported.
+// It returns an error when the template does not parse.
+func (c *Checker) Check(name, text string) ([]Problem, error) {
+	w, err := c.check(name, text)
+	if err != nil {
+		return nil, err
+	}
+	return w.problems, nil
+}
+
+// check walks the template text.
+func (c *Checker) check(name, text string) (*walker, error) {
+	t := parse.New(name)
+	t.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	if _, err := t.Parse(text, c.LeftDelim, c.RightDelim, trees); err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range trees {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	w := &walker{Checker: c, name: name, text: text, dots: map[string]value{}, calls: map[string][]export.Position{}}
+	if c.Data != nil {
+		w.dots[name] = typedValue(c.Data)
+	}
+
+	// the top level template is given the data, the templates it invokes
+	// are given the dot of their invocations, the others are not known.
+	walked := map[string]bool{}
+	for len(walked) < len(trees) {
+		next := ""
+		for _, n := range names {
+			if _, ok := w.dots[n]; ok && !walked[n] || n == name && !walked[n] {
+				next = n
+				break
+			}
+		}
+		if next == "" {
+			for _, n := range names {
+				if !walked[n] {
+					next = n
+					break
+				}
+			}
+		}
+		walked[next] = true
+		w.tree(trees[next], w.dots[next])
+	}
+
+	// the problems are reported in order of their position.
+	sort.SliceStable(w.problems, func(i, j int) bool {
+		a, b := w.problems[i].Pos, w.problems[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return w, nil
+}
+
+// walker walks the nodes of the trees of a template text.
+type walker struct {
+	*Checker
+	name     string
+	text     string
+	problems []Problem
+	// dot is the value of the dot.
+	dot value
+	// vars are the variables in scope, the last declared last.
+	vars []variable
+	// dots are the dots given to the templates invoked, by name.
+	dots map[string]value
+	// calls are the positions of the calls of the funcmap functions, by name.
+	calls map[string][]export.Position
+}
+
+// variable is a template variable, such as $x.
+type variable struct {
+	name string
+	v    value
+}
+
+// tree checks a template, dot is the data it is executed with.
+func (w *walker) tree(t *parse.Tree, dot value) {
+	w.dot = dot
+	w.vars = []variable{{name: "$", v: dot}}
+	w.walk(t.Root)
+}
+
+func (w *walker) walk(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, x := range n.Nodes {
+			w.walk(x)
+		}
+	case *parse.ActionNode:
+		w.pipe(n.Pipe)
+	case *parse.IfNode:
+		w.branch(&n.BranchNode)
+	case *parse.RangeNode:
+		w.branch(&n.BranchNode)
+	case *parse.WithNode:
+		w.branch(&n.BranchNode)
+	case *parse.TemplateNode:
+		v := w.pipe(n.Pipe)
+		// a template invoked with values of different types has an unknown dot.
+		if prev, ok := w.dots[n.Name]; ok && prev.Type != v.Type {
+			v = value{}
+		}
+		w.dots[n.Name] = v
+	}
+}
+
+// branch checks an if, range or with block,
+// the variables it declares are scoped to the block.
+// The dot of a range block is the element of the pipeline,
+// the dot of a with block is the pipeline.
+func (w *walker) branch(n *parse.BranchNode) {
+	scope := len(w.vars)
+	dot := w.dot
+	switch n.NodeType {
+	case parse.NodeRange:
+		// range $i, $e := pipeline
+		v := w.commands(n.Pipe)
+		key, elem := rangeOf(v)
+		decl := []value{elem}
+		if len(n.Pipe.Decl) > 1 {
+			decl = []value{key, elem}
+		}
+		for i, d := range n.Pipe.Decl {
+			if i < len(decl) {
+				w.declare(d, decl[i], n.Pipe.IsAssign)
+			}
+		}
+		w.dot = elem
+	case parse.NodeWith:
+		w.dot = w.pipe(n.Pipe)
+	default:
+		w.pipe(n.Pipe)
+	}
+	w.walk(n.List)
+	w.vars = w.vars[:scope]
+	w.dot = dot
+	w.walk(n.ElseList)
+	w.vars = w.vars[:scope]
+}
+
+// pipe checks the commands of a pipeline, and declares its variables.
+func (w *walker) pipe(pipe *parse.PipeNode) value {
+	if pipe == nil {
+		return value{}
+	}
+	v := w.commands(pipe)
+	for _, d := range pipe.Decl {
+		w.declare(d, v, pipe.IsAssign)
+	}
+	return v
+}
+
+// commands checks the commands of a pipeline,
+// a command is given the result of the previous one as its last argument.
+// It returns the value of the last command.
+func (w *walker) commands(pipe *parse.PipeNode) value {
+	var v value
+	for i, cmd := range pipe.Cmds {
+		var piped *value
+		if i > 0 {
+			piped = &v
+		}
+		v = w.command(cmd, piped)
+	}
+	return v
+}
+
+// declare declares or assigns a variable.
+func (w *walker) declare(n *parse.VariableNode, v value, isAssign bool) {
+	if isAssign {
+		for i := len(w.vars) - 1; i >= 0; i-- {
+			if w.vars[i].name == n.Ident[0] {
+				// the variable may be given values of different types.
+				if w.vars[i].v.Type != v.Type {
+					w.vars[i].v = value{}
+				}
+				return
+			}
+		}
+	}
+	w.vars = append(w.vars, variable{name: n.Ident[0], v: v.typed()})
+}
+
+// variable returns the value of the variable of given name.
+func (w *walker) variable(name string) value {
+	for i := len(w.vars) - 1; i >= 0; i-- {
+		if w.vars[i].name == name {
+			return w.vars[i].v
+		}
+	}
+	return value{}
+}
+
+// command checks a command, piped is the result of the previous command.
+// It returns the value of the command.
+func (w *walker) command(cmd *parse.CommandNode, piped *value) value {
+	var args []arg
+	for _, a := range cmd.Args[1:] {
+		args = append(args, arg{node: a, v: w.operand(a)})
+	}
+	if piped != nil {
+		args = append(args, arg{v: *piped})
+	}
+
+	switch n := cmd.Args[0].(type) {
+	case *parse.IdentifierNode:
+		return w.call(n, args)
+	case *parse.FieldNode:
+		return w.fields(w.dot, n.Ident, n, args)
+	case *parse.ChainNode:
+		return w.fields(w.operand(n.Node), n.Field, n, args)
+	case *parse.VariableNode:
+		return w.fields(w.variable(n.Ident[0]), n.Ident[1:], n, args)
+	}
+	if len(args) > 0 {
+		w.reportAt("", cmd.Position(), "can't give argument to non-function %v", cmd.Args[0])
+	}
+	return w.operand(cmd.Args[0])
+}
+
+// operand returns the value of an argument of a command.
+func (w *walker) operand(node parse.Node) value {
+	switch n := node.(type) {
+	case *parse.IdentifierNode:
+		// an identifier argument is called without arguments.
+		return w.call(n, nil)
+	case *parse.PipeNode:
+		return w.pipe(n)
+	case *parse.FieldNode:
+		return w.fields(w.dot, n.Ident, n, nil)
+	case *parse.ChainNode:
+		return w.fields(w.operand(n.Node), n.Field, n, nil)
+	case *parse.VariableNode:
+		return w.fields(w.variable(n.Ident[0]), n.Ident[1:], n, nil)
+	case *parse.DotNode:
+		return w.dot
+	case *parse.StringNode:
+		return value{Type: "string", Kind: "string", Untyped: true, Const: n.Text, IsConst: true}
+	case *parse.BoolNode:
+		return value{Type: "bool", Kind: "bool", Untyped: true}
+	case *parse.NilNode:
+		return value{Type: "nil", Kind: "nil", Untyped: true}
+	case *parse.NumberNode:
+		switch {
+		case n.IsInt || n.IsUint:
+			return value{Type: "int", Kind: "int", Untyped: true}
+		case n.IsFloat:
+			return value{Type: "float64", Kind: "float64", Untyped: true}
+		case n.IsComplex:
+			return value{Type: "complex128", Kind: "complex128", Untyped: true}
+		}
+	}
+	return value{}
+}
+
+// fields returns the value of a chain of fields and methods of v,
+// such as .User.Profile.Name, the last one is given args.
+func (w *walker) fields(v value, names []string, node parse.Node, args []arg) value {
+	for i, name := range names {
+		var a []arg
+		if i == len(names)-1 {
+			a = args
+		}
+		v = w.field(v, name, node, a)
+	}
+	if len(names) == 0 && len(args) > 0 {
+		w.reportAt("", node.Position(), "can't give argument to non-function %v", node)
+	}
+	return v
+}
+
+// field returns the value of the field or method name of v,
+// the way text/template evaluates .Name, a method is given args.
+// The fields of values whose types are not known are not checked.
+func (w *walker) field(v value, name string, node parse.Node, args []arg) value {
+	if v.t == nil {
+		return value{}
+	}
+	t := v.t
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		// the field of the dynamic value.
+		return value{}
+	}
+
+	var pkg *types.Package
+	if n, ok := deref(t).(*types.Named); ok {
+		pkg = n.Obj().Pkg()
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, pkg, name)
+	switch obj := obj.(type) {
+	case *types.Func:
+		if obj.Exported() {
+			fn := export.DescribeSignature(obj.Type().(*types.Signature))
+			return w.checkCall(name, node.Position(), fn, args)
+		}
+	case *types.Var:
+		if !obj.Exported() {
+			w.reportAt("", node.Position(), "%v is an unexported field of struct type %v", name, v.Type)
+			return value{}
+		}
+		if len(args) > 0 {
+			w.reportAt("", node.Position(), "%v has arguments but cannot be invoked as function", name)
+		}
+		return typedValue(obj.Type())
+	}
+
+	if m, ok := deref(t).Underlying().(*types.Map); ok {
+		if b, ok := m.Key().Underlying().(*types.Basic); ok && b.Info()&types.IsString != 0 {
+			if len(args) > 0 {
+				w.reportAt("", node.Position(), "%v is not a method but has arguments", name)
+			}
+			return typedValue(m.Elem())
+		}
+	}
+	w.reportAt("", node.Position(), "can't evaluate field %v in type %v", name, v.Type)
+	return value{}
+}
+
+// arg is an argument given to a function,
+// node is nil for the piped value.
+type arg struct {
+	node parse.Node
+	v    value
+}
+
+// call checks the call of a function of the funcmaps with args,
+// it returns the value of its result.
+func (w *walker) call(ident *parse.IdentifierNode, args []arg) value {
+	fn, ok := w.Funcs[ident.Ident]
+	if !ok {
+		w.report(ident, "unknown function %q", ident.Ident)
+		return value{}
+	}
+	w.calls[ident.Ident] = append(w.calls[ident.Ident], w.position(ident.Position()))
+	return w.checkCall(ident.Ident, ident.Position(), fn, args)
+}
+
+// checkCall checks the call of a function or a method with args,
+// it returns the value of its result.
+func (w *walker) checkCall(name string, pos parse.Pos, fn export.Func, args []arg) value {
+	n := len(args)
+	want := len(fn.Params)
+	switch {
+	case fn.Variadic && n < want-1:
+		w.reportAt(name, pos, "wrong number of arguments for %q: want at least %v, got %v", name, want-1, n)
+	case !fn.Variadic && n > want:
+		w.reportAt(name, pos, "too many arguments for %q: want %v, got %v, it is not variadic", name, want, n)
+	case !fn.Variadic && n < want:
+		w.reportAt(name, pos, "wrong number of arguments for %q: want %v, got %v", name, want, n)
+	default:
+		w.arguments(name, pos, fn, args)
+	}
+
+	ret, ok := result(fn)
+	if !ok {
+		w.reportAt(name, pos, "%q can not be called from a template, it must return one value, or one value and an error", name)
+	}
+	return ret
+}
+
+// arguments checks the types of the arguments of a call.
+func (w *walker) arguments(name string, pos parse.Pos, fn export.Func, args []arg) {
+	for i, a := range args {
+		p := fn.Params[len(fn.Params)-1]
+		if i < len(fn.Params)-1 || !fn.Variadic {
+			p = fn.Params[i]
+		}
+		want := strings.TrimPrefix(p.Type, "...")
+		if assignable(a.v, want, p.Kind) {
+			continue
+		}
+		if a.node == nil {
+			w.reportAt(name, pos, "wrong type for the piped value of %q: want %v, got %v", name, want, a.v)
+		} else {
+			w.reportAt(name, a.node.Position(), "wrong type for argument %v of %q: want %v, got %v", i+1, name, want, a.v)
+		}
+	}
+	if isPrintf(fn) {
+		w.printf(name, pos, args)
+	}
+}
+
+func (w *walker) report(ident *parse.IdentifierNode, format string, args ...interface{}) {
+	w.reportAt(ident.Ident, ident.Position(), format, args...)
+}
+
+func (w *walker) reportAt(funcName string, pos parse.Pos, format string, args ...interface{}) {
+	w.problems = append(w.problems, Problem{
+		Pos:  w.position(pos),
+		Func: funcName,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+// position returns the line and column of an offset of the text.
+func (w *walker) position(pos parse.Pos) export.Position {
+	before := w.text[:pos]
+	line := 1 + strings.Count(before, "\n")
+	col := int(pos) - strings.LastIndex(before, "\n")
+	return export.Position{Filename: w.name, Line: line, Column: col}
+}
@@ -0,0 +1,273 @@
+package check_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mh-cbon/export-funcmap/check"
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+func newChecker(t *testing.T) *check.Checker {
+	export.EnableCache = false
+	targets := export.Targets{}
+	if err := targets.Parse([]string{"@text/template"}); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := export.Config{}.Describe(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := check.New(desc)
+	funcmap := "test:funcs"
+	// func(s string, n int) string
+	c.Funcs["repeat"] = export.Func{
+		Name:    "repeat",
+		Funcmap: funcmap,
+		Params:  []export.Param{{Name: "s", Type: "string", Kind: "string"}, {Name: "n", Type: "int", Kind: "int"}},
+		Results: []export.Param{{Type: "string", Kind: "string"}},
+	}
+	// func(s string) (string, error)
+	c.Funcs["upper"] = export.Func{
+		Name:    "upper",
+		Funcmap: funcmap,
+		Params:  []export.Param{{Name: "s", Type: "string", Kind: "string"}},
+		Results: []export.Param{{Type: "string", Kind: "string"}, {Type: "error", Kind: "interface"}},
+	}
+	// func() []*template.Template
+	c.Funcs["templates"] = export.Func{
+		Name:    "templates",
+		Funcmap: funcmap,
+		Results: []export.Param{{Type: "[]*template.Template", Kind: "slice"}},
+	}
+	// func(t template.Template) template.HTML
+	c.Funcs["render"] = export.Func{
+		Name:    "render",
+		Funcmap: funcmap,
+		Params:  []export.Param{{Name: "t", Type: "template.Template", Kind: "struct"}},
+		Results: []export.Param{{Type: "template.HTML", Kind: "string"}},
+	}
+	// func(s string)
+	c.Funcs["nothing"] = export.Func{
+		Name:    "nothing",
+		Funcmap: funcmap,
+		Params:  []export.Param{{Name: "s", Type: "string", Kind: "string"}},
+	}
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	c := newChecker(t)
+
+	datas := []struct {
+		text           string
+		expectProblems []string
+	}{
+		{`{{ printf "%v" . | html }}{{ repeat "a" 2 }}`, nil},
+		{`{{ .x | repeat "a" }}`, nil},
+		{`{{ if eq . 1 }}{{ else }}{{ len . }}{{ end }}`, nil},
+		{`{{ nope . }}`, []string{`t.tmpl:1:4: unknown function "nope"`}},
+		{"a\n{{ repeat \"a\" }}", []string{`t.tmpl:2:4: wrong number of arguments for "repeat": want 2, got 1`}},
+		{`{{ repeat "a" 1 2 }}`, []string{`t.tmpl:1:4: too many arguments for "repeat": want 2, got 3, it is not variadic`}},
+		{`{{ "a" | repeat "a" 1 }}`, []string{`t.tmpl:1:10: too many arguments for "repeat": want 2, got 3, it is not variadic`}},
+		{`{{ index }}`, []string{`t.tmpl:1:4: wrong number of arguments for "index": want at least 1, got 0`}},
+		{`{{ printf "%v" (nope 1) }}`, []string{`t.tmpl:1:17: unknown function "nope"`}},
+		{`{{ printf "%v" nope }}`, []string{`t.tmpl:1:16: unknown function "nope"`}},
+		{`{{ define "x" }}{{ nope }}{{ end }}{{ range . }}{{ template "x" nope2 }}{{ end }}`, []string{
+			`t.tmpl:1:20: unknown function "nope"`,
+			`t.tmpl:1:65: unknown function "nope2"`,
+		}},
+		{`{{ with $x := nope }}{{ end }}`, []string{`t.tmpl:1:15: unknown function "nope"`}},
+		{`{{ nothing "a" }}`, []string{`t.tmpl:1:4: "nothing" can not be called from a template, it must return one value, or one value and an error`}},
+		{`{{ repeat 1 "a" }}`, []string{
+			`t.tmpl:1:11: wrong type for argument 1 of "repeat": want string, got untyped int`,
+			`t.tmpl:1:13: wrong type for argument 2 of "repeat": want int, got untyped string`,
+		}},
+		{`{{ repeat "a" 1.5 }}`, []string{`t.tmpl:1:15: wrong type for argument 2 of "repeat": want int, got untyped float64`}},
+		{`{{ 2 | repeat "a" }}{{ "a" | upper | repeat "a" }}`, []string{`t.tmpl:1:38: wrong type for the piped value of "repeat": want int, got string`}},
+		{`{{ upper (repeat "a" 1) | len }}{{ render (index templates 0) }}{{ upper (render nil) }}`, []string{
+			`t.tmpl:1:75: wrong type for argument 1 of "upper": want string, got template.HTML`,
+			`t.tmpl:1:82: wrong type for argument 1 of "render": want template.Template, got nil`,
+		}},
+		{`{{ range $i, $t := templates }}{{ render $t }}{{ repeat "a" $i }}{{ upper $t }}{{ end }}`, []string{
+			`t.tmpl:1:75: wrong type for argument 1 of "upper": want string, got *template.Template`,
+		}},
+		{`{{ $x := 1 }}{{ if true }}{{ $x := "a" }}{{ upper $x }}{{ end }}{{ upper $x }}`, []string{
+			`t.tmpl:1:74: wrong type for argument 1 of "upper": want string, got int`,
+		}},
+		{`{{ .Name | upper | printf "%d" }}{{ printf "%s %d" "a" 1 }}{{ printf "%5.2f %t" 1.5 }}`, []string{
+			`t.tmpl:1:20: format %d of "printf" has arg #1 of wrong type string`,
+			`t.tmpl:1:63: format %t of "printf" reads arg #2, but call has 1 args`,
+		}},
+	}
+
+	for _, data := range datas {
+		problems, err := c.Check("t.tmpl", data.text)
+		if err != nil {
+			t.Errorf("Test %v: %v", data.text, err)
+			continue
+		}
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(data.expectProblems, "\n") {
+			t.Errorf("Test %v: Invalid problems,\nexpected=%v\ngot=%v", data.text, data.expectProblems, got)
+		}
+	}
+
+	if _, err := c.Check("t.tmpl", `{{ if }}`); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	c := newChecker(t)
+	c.LeftDelim, c.RightDelim = "[[", "]]"
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.tmpl":     `[[ nope ]]`,
+		"sub/b.html": `{{ nope }}[[ html . ]][[ repeat ]]`,
+		"c.txt":      `[[ nope ]]`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := c.CheckFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, strings.TrimPrefix(p.String(), dir+string(filepath.Separator)))
+	}
+	expect := []string{
+		`a.tmpl:1:4: unknown function "nope"`,
+		`sub/b.html:1:26: wrong number of arguments for "repeat": want 2, got 0`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("Invalid problems,\nexpected=%v\ngot=%v", expect, got)
+	}
+}
+
+func TestCheckData(t *testing.T) {
+	c := newChecker(t)
+	prog, err := export.GetProgram([]string{"github.com/mh-cbon/export-funcmap/check/testdata/views"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Data, err = check.DataType(prog, "github.com/mh-cbon/export-funcmap/check/testdata/views.PageData")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datas := []struct {
+		text           string
+		expectProblems []string
+	}{
+		{`{{ .Title | upper }}{{ .User.Profile.Age | repeat .User.Name }}{{ .User.Greet "hi" }}{{ .Extra.Anything }}`, nil},
+		{`{{ .Titel }}{{ .User.Profile.Name }}`, []string{
+			`t.tmpl:1:4: can't evaluate field Titel in type views.PageData`,
+			`t.tmpl:1:21: can't evaluate field Name in type views.Profile`,
+		}},
+		{`{{ .count }}{{ .Title "a" }}{{ .Tags.go "a" }}`, []string{
+			`t.tmpl:1:4: count is an unexported field of struct type views.PageData`,
+			`t.tmpl:1:16: Title has arguments but cannot be invoked as function`,
+			`t.tmpl:1:37: go is not a method but has arguments`,
+		}},
+		{`{{ repeat .Title .Title }}{{ .User.Greet 1 }}{{ .User.Greet }}`, []string{
+			`t.tmpl:1:18: wrong type for argument 2 of "repeat": want int, got string`,
+			`t.tmpl:1:42: wrong type for argument 1 of "Greet": want string, got untyped int`,
+			`t.tmpl:1:54: wrong number of arguments for "Greet": want 1, got 0`,
+		}},
+		{`{{ range $i, $u := .Users }}{{ upper .Name }}{{ repeat $u.Name $i }}{{ upper .Profile.Age }}{{ else }}{{ .Title }}{{ end }}`, []string{
+			`t.tmpl:1:86: wrong type for argument 1 of "upper": want string, got int`,
+		}},
+		{`{{ with .User }}{{ .Name }}{{ if .IsAdult }}{{ .Title }}{{ end }}{{ else }}{{ .Title }}{{ end }}`, []string{
+			`t.tmpl:1:48: can't evaluate field Title in type *views.User`,
+		}},
+		{`{{ range $k, $v := .Tags }}{{ repeat $k $v }}{{ end }}{{ $.Title }}{{ $.Nope }}`, []string{
+			`t.tmpl:1:72: can't evaluate field Nope in type views.PageData`,
+		}},
+		{`{{ define "user" }}{{ .Name }}{{ .Title }}{{ end }}{{ template "user" .User }}`, []string{
+			`t.tmpl:1:34: can't evaluate field Title in type *views.User`,
+		}},
+		{`{{ (index .Users 0).Name }}{{ .Body | upper }}`, []string{
+			`t.tmpl:1:39: wrong type for the piped value of "upper": want string, got template.HTML`,
+		}},
+	}
+
+	for _, data := range datas {
+		problems, err := c.Check("t.tmpl", data.text)
+		if err != nil {
+			t.Errorf("Test %v: %v", data.text, err)
+			continue
+		}
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(data.expectProblems, "\n") {
+			t.Errorf("Test %v: Invalid problems,\nexpected=%v\ngot=%v", data.text, data.expectProblems, got)
+		}
+	}
+
+	if _, err := check.DataType(prog, "views.Nope"); err == nil {
+		t.Error("Expected an error for an invalid data type")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	c := newChecker(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.tmpl": "{{ upper . }}\n{{ repeat . 1 | upper }}",
+		"b.tmpl": `{{ define "x" }}{{ html . }}{{ end }}`,
+		"c.txt":  `{{ render . }}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := c.Usage(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Filter("text/template:builtins")
+
+	var b bytes.Buffer
+	if err := u.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(b.String(), dir+string(filepath.Separator), "")
+	expect := `unused	nothing	test:funcs
+unused	render	test:funcs
+unused	templates	test:funcs
+used	repeat	test:funcs
+	a.tmpl:2:4
+used	upper	test:funcs
+	a.tmpl:1:4
+	a.tmpl:2:17
+`
+	if got != expect {
+		t.Errorf("Invalid report,\nexpected=%q\ngot=%q", expect, got)
+	}
+
+	if _, err := c.Usage(filepath.Join(dir, "*.nope")); err == nil {
+		t.Error("Expected an error for a glob matching no files")
+	}
+}
@@ -0,0 +1,36 @@
+// Package views declares the data of the templates checked by the tests.
+package views
+
+import "html/template"
+
+// PageData is the data of a page.
+type PageData struct {
+	Title string
+	User  *User
+	Users []User
+	Tags  map[string]int
+	Body  template.HTML
+	Extra interface{}
+	count int
+}
+
+// User is a user of the site.
+type User struct {
+	Name    string
+	Profile Profile
+}
+
+// Profile describes a user.
+type Profile struct {
+	Age int
+}
+
+// Greet returns a greeting of the user.
+func (u *User) Greet(greeting string) string {
+	return greeting + " " + u.Name
+}
+
+// IsAdult tells if the user is an adult.
+func (u User) IsAdult() (bool, error) {
+	return u.Profile.Age >= 18, nil
+}
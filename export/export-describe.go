@@ -0,0 +1,243 @@
+package export
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// Description is a machine readable description of the funcmaps of targets,
+// it serializes to JSON.
+type Description struct {
+	Funcs []Func `json:"funcs"`
+	// Vars lists the described funcmap variables.
+	Vars []ExportedVar `json:"vars"`
+	// Conflicts lists the keys set by several funcmaps.
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	// Warnings report the variables of the packages
+	// that were skipped because they are not funcmaps,
+	// and the renamed keys that do not exist.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Func describes a function of a funcmap.
+type Func struct {
+	// Name is the key of the function in the funcmap.
+	Name     string  `json:"name"`
+	Params   []Param `json:"params"`
+	Results  []Param `json:"results"`
+	Variadic bool    `json:"variadic"`
+	// Sel and Pkg are the origin of a function declared at the package level,
+	// such as template.HTMLEscaper and text/template,
+	// they are empty for func literals and local values.
+	Sel string `json:"sel,omitempty"`
+	Pkg string `json:"pkg,omitempty"`
+	// Funcmap is the variable the function belongs to, as pkgpath:var.
+	Funcmap string `json:"funcmap"`
+	// Pos is the position of the function value in the source.
+	Pos Position `json:"pos"`
+	// Decl is the position of the declaration of a function
+	// declared at the package level, in the source of its package,
+	// it is Pos for func literals and local values.
+	Decl Position `json:"decl"`
+	// Doc is the doc comment of a function declared at the package level.
+	Doc string `json:"doc,omitempty"`
+}
+
+// Param describes a parameter or a result of a function.
+type Param struct {
+	// Name is empty for unnamed parameters.
+	Name string `json:"name,omitempty"`
+	// Type is the type as written in the package of the function,
+	// qualified by package names, such as []*template.Template.
+	Type string `json:"type"`
+	// ImportPath is the import path of the named type Type is made of,
+	// it is empty for predeclared and unnamed types.
+	ImportPath string `json:"importPath,omitempty"`
+	// Kind is the kind of the underlying type of Type,
+	// the name of a basic type such as string or int,
+	// or one of interface, ptr, slice, array, map, chan, func and struct.
+	// The elements of a variadic parameter are of Kind.
+	Kind string `json:"kind"`
+}
+
+// Position is a source position.
+type Position struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+func (p Position) String() string {
+	return token.Position{Filename: p.Filename, Line: p.Line, Column: p.Column}.String()
+}
+
+// Describe describes the functions of the funcmaps of targets.
+// Targets without idents describe every funcmap variable of their package.
+// Signatures are described with their actual types,
+// the Unexported policy does not apply.
+func (c Config) Describe(targets Targets) (*Description, error) {
+
+	prog, err := c.program(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, warnings, err := targets.Expand(prog)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, w, err := collectEntries(prog, targets)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, w...)
+	entries, conflicts, err := mergeEntries(prog, entries, c.Merge)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Description{Funcs: []Func{}, Vars: []ExportedVar{}, Conflicts: conflicts, Warnings: warnings}
+	loadFuncPackages(prog, entries)
+	for _, entry := range entries {
+		fn, err := describeEntry(prog, entry)
+		if err != nil {
+			return nil, err
+		}
+		res.Funcs = append(res.Funcs, fn)
+	}
+	for _, target := range targets {
+		for _, ident := range target.Idents {
+			res.Vars = append(res.Vars, ExportedVar{PkgPath: target.PkgPath, Ident: ident})
+		}
+	}
+
+	return res, nil
+}
+
+// describeEntry describes the function of a funcmap entry.
+func describeEntry(prog *Program, entry funcEntry) (Func, error) {
+	signature, err := entry.Signature()
+	if err != nil {
+		return Func{}, err
+	}
+
+	pos := entry.Position()
+	fn := DescribeSignature(signature)
+	fn.Name = entry.Key
+	fn.Funcmap = entry.TargetPkg + ":" + entry.TargetVar
+	fn.Pos = Position{Filename: pos.Filename, Line: pos.Line, Column: pos.Column}
+	fn.Decl = fn.Pos
+	if obj := publicFunc(entry); obj != nil {
+		fn.Sel = obj.Pkg().Name() + "." + obj.Name()
+		fn.Pkg = obj.Pkg().Path()
+	}
+	if obj := usedObject(entry.Pkg, genericFunc(entry.Pkg, entry.Value)); obj != nil && isPackageLevel(obj) {
+		decl := prog.Fset.Position(sourceObject(prog, obj).Pos())
+		if decl.IsValid() {
+			fn.Decl = Position{Filename: decl.Filename, Line: decl.Line, Column: decl.Column}
+		}
+		if f, ok := obj.(*types.Func); ok {
+			fn.Doc = funcDoc(prog, f)
+		}
+	}
+	return fn, nil
+}
+
+// DescribeSignature describes the parameters and results of a signature,
+// the Func returned has no name nor origin.
+func DescribeSignature(signature *types.Signature) Func {
+	return Func{
+		Params:   describeTuple(signature.Params(), signature.Variadic()),
+		Results:  describeTuple(signature.Results(), false),
+		Variadic: signature.Variadic(),
+	}
+}
+
+// DescribeType describes a type as a Param without name.
+func DescribeType(t types.Type) Param {
+	return Param{
+		Type:       types.TypeString(t, packageName),
+		ImportPath: typeImportPath(t),
+		Kind:       typeKind(t),
+	}
+}
+
+// describeTuple describes the variables of a tuple,
+// the last one is written ...T when isVariadic.
+func describeTuple(tuple *types.Tuple, isVariadic bool) []Param {
+	ret := []Param{}
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		t := v.Type()
+		prefix := ""
+		if isVariadic && i == tuple.Len()-1 {
+			if s, ok := t.(*types.Slice); ok {
+				t = s.Elem()
+				prefix = "..."
+			}
+		}
+		p := DescribeType(t)
+		p.Name = v.Name()
+		p.Type = prefix + p.Type
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func packageName(p *types.Package) string {
+	return p.Name()
+}
+
+// typeKind returns the kind of the underlying type of t.
+func typeKind(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Name()
+	case *types.Interface:
+		return "interface"
+	case *types.Pointer:
+		return "ptr"
+	case *types.Slice:
+		return "slice"
+	case *types.Array:
+		return "array"
+	case *types.Map:
+		return "map"
+	case *types.Chan:
+		return "chan"
+	case *types.Signature:
+		return "func"
+	case *types.Struct:
+		return "struct"
+	}
+	return ""
+}
+
+// typeImportPath returns the import path of the named type t is made of,
+// such as html/template for []*template.Template.
+func typeImportPath(t types.Type) string {
+	for {
+		switch x := t.(type) {
+		case *types.Alias:
+			t = types.Unalias(x)
+		case *types.Pointer:
+			t = x.Elem()
+		case *types.Slice:
+			t = x.Elem()
+		case *types.Array:
+			t = x.Elem()
+		case *types.Chan:
+			t = x.Elem()
+		case *types.Map:
+			t = x.Elem()
+		case *types.Named:
+			if x.Obj().Pkg() == nil {
+				return ""
+			}
+			return x.Obj().Pkg().Path()
+		default:
+			return ""
+		}
+	}
+}
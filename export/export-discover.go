@@ -0,0 +1,82 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"go/types"
+	"sort"
+)
+
+// Discover returns the names of the funcmap variables
+// declared at the package level of pkgPath,
+// in their order of declaration.
+// A funcmap variable is a map[string]interface{},
+// or a named type of it such as template.FuncMap,
+// whose values are functions.
+// The other variables of such types, such as a map never assigned
+// or a map of strings, are skipped, the warnings report them.
+func Discover(prog *Program, pkgPath string) ([]string, []string, error) {
+	ourpkg, err := getPackage(prog, pkgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vars []*types.Var
+	for _, obj := range findMapStringInterface(ourpkg.Types, ourpkg.TypesInfo.Defs) {
+		if v, ok := obj.(*types.Var); ok {
+			vars = append(vars, v)
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Pos() < vars[j].Pos()
+	})
+
+	var ret, warnings []string
+	for _, v := range vars {
+		err := funcMapErr(prog, pkgPath, v.Name())
+		var unsupported *UnsupportedExprError
+		if errors.As(err, &unsupported) {
+			warnings = append(warnings, fmt.Sprintf("%v:%v is skipped, %v", pkgPath, v.Name(), err))
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		ret = append(ret, v.Name())
+	}
+	return ret, warnings, nil
+}
+
+// funcMapErr returns the error of the export of a variable,
+// nil when it is a funcmap whose values are functions.
+func funcMapErr(prog *Program, pkgPath, name string) error {
+	entries, _, err := targetEntries(prog, Target{PkgPath: pkgPath, Idents: []string{name}})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := e.Signature(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expand returns a copy of the targets,
+// targets without idents are given every funcmap variable of their package,
+// the warnings report the variables Discover skipped.
+func (t Targets) Expand(prog *Program) (Targets, []string, error) {
+	var ret Targets
+	var warnings []string
+	for _, target := range t {
+		if len(target.Idents) == 0 {
+			idents, skipped, err := Discover(prog, target.PkgPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			target.Idents = idents
+			warnings = append(warnings, skipped...)
+		}
+		ret = append(ret, target)
+	}
+	return ret, warnings, nil
+}
@@ -0,0 +1,92 @@
+package export
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// TargetNotFoundError is returned when a target variable
+// is not declared in its package, or is not a funcmap.
+type TargetNotFoundError struct {
+	PkgPath string
+	Var     string
+}
+
+func (e *TargetNotFoundError) Error() string {
+	return fmt.Sprintf("variable %v not found in %v", e.Var, e.PkgPath)
+}
+
+// UnsupportedTypeError is returned when the signature of a funcmap entry
+// uses a type that can not be exported.
+type UnsupportedTypeError struct {
+	// PkgPath and Var are the funcmap the entry belongs to,
+	// they are empty for a funcmap exported with FromFuncMap.
+	PkgPath string
+	Var     string
+	Key     string
+	// Pos is the position of the entry value.
+	Pos token.Position
+	// Err tells why the type is not supported.
+	Err error
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	origin := ""
+	if e.Var != "" {
+		origin = fmt.Sprintf(" of %v:%v", e.PkgPath, e.Var)
+	}
+	return fmt.Sprintf("key %q%v at %v: %v", e.Key, origin, e.Pos, e.Err)
+}
+
+func (e *UnsupportedTypeError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedExprError is returned when the value flow of a funcmap
+// goes through an expression that can not be analyzed,
+// or when the value of a funcmap entry is not a function.
+type UnsupportedExprError struct {
+	// PkgPath and Var are the funcmap the expression belongs to.
+	PkgPath string
+	Var     string
+	// Key is the funcmap key whose value is not supported,
+	// it is empty when the expression is not the value of a key.
+	Key  string
+	Expr string
+	// Pos is the position of the expression.
+	Pos token.Position
+	// Reason tells why a supported expression can not be exported,
+	// such as a value that is not a function.
+	Reason string
+}
+
+func (e *UnsupportedExprError) Error() string {
+	origin := ""
+	if e.Var != "" {
+		origin = fmt.Sprintf(" of %v:%v", e.PkgPath, e.Var)
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("unsupported funcmap expression %v%v at %v", e.Expr, origin, e.Pos)
+	}
+	subject := e.Expr
+	if e.Key != "" {
+		subject = fmt.Sprintf("value of key %q", e.Key)
+	}
+	return fmt.Sprintf("%v%v %v at %v", subject, origin, e.Reason, e.Pos)
+}
+
+// KeyConflictError is returned by the MergeError policy
+// when a key is set by several funcmaps,
+// and when two keys of a funcmap are remapped to the same key.
+type KeyConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *KeyConflictError) Error() string {
+	var lines []string
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,698 @@
+package export
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// funcEntry is a key of a funcmap along with the expression of its value.
+type funcEntry struct {
+	Key   string
+	Value ast.Expr
+	// Pkg is the package declaring Value.
+	Pkg *packages.Package
+	// TargetPkg and TargetVar are the funcmap the entry belongs to.
+	TargetPkg string
+	TargetVar string
+	// Builtin tells the value is called by the template package itself.
+	Builtin bool
+}
+
+// Signature returns the signature of the entry value,
+// generic functions are given their instantiated signature.
+func (e funcEntry) Signature() (*types.Signature, error) {
+	t := e.Pkg.TypesInfo.TypeOf(e.Value)
+	if t != nil {
+		if s, ok := t.Underlying().(*types.Signature); ok {
+			if s.TypeParams().Len() > 0 {
+				return nil, e.unsupported("is a generic function that is not instantiated")
+			}
+			if e.Builtin {
+				return builtinSignature(s), nil
+			}
+			return s, nil
+		}
+	}
+	return nil, e.unsupported("is not a function")
+}
+
+// unsupported returns an error about the value of the entry.
+func (e funcEntry) unsupported(reason string) error {
+	return &UnsupportedExprError{
+		PkgPath: e.TargetPkg,
+		Var:     e.TargetVar,
+		Key:     e.Key,
+		Expr:    exprString(e.Value),
+		Pos:     e.Pkg.Fset.Position(e.Value.Pos()),
+		Reason:  reason,
+	}
+}
+
+// Position returns the position of the entry value.
+func (e funcEntry) Position() token.Position {
+	return e.Pkg.Fset.Position(e.Value.Pos())
+}
+
+// builtinSignature returns the signature of a builtin template func
+// with its reflect.Value parameters and results replaced by interface{},
+// the template package converts the values it passes and receives.
+func builtinSignature(s *types.Signature) *types.Signature {
+	anyType := types.NewInterfaceType(nil, nil)
+	tuple := func(t *types.Tuple) *types.Tuple {
+		var vars []*types.Var
+		for i := 0; i < t.Len(); i++ {
+			v := t.At(i)
+			vt := v.Type()
+			if isReflectValue(vt) {
+				vt = anyType
+			} else if s, ok := vt.(*types.Slice); ok && isReflectValue(s.Elem()) {
+				vt = types.NewSlice(anyType)
+			}
+			vars = append(vars, types.NewParam(v.Pos(), v.Pkg(), v.Name(), vt))
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.NewSignatureType(nil, nil, nil, tuple(s.Params()), tuple(s.Results()), s.Variadic())
+}
+
+func isReflectValue(t types.Type) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	return ok && n.Obj().Pkg() != nil && n.Obj().Pkg().Path() == "reflect" && n.Obj().Name() == "Value"
+}
+
+// funcEntries is an ordered set of funcmap entries,
+// setting a key twice replaces its value.
+type funcEntries []funcEntry
+
+func (e *funcEntries) set(entry funcEntry) {
+	for i := range *e {
+		if (*e)[i].Key == entry.Key {
+			(*e)[i] = entry
+			return
+		}
+	}
+	*e = append(*e, entry)
+}
+
+func (e *funcEntries) del(key string) {
+	for i := range *e {
+		if (*e)[i].Key == key {
+			*e = append((*e)[:i], (*e)[i+1:]...)
+			return
+		}
+	}
+}
+
+// targetEntries returns the entries of the funcmaps of target,
+// in their order of declaration, and the warnings of their remap.
+func targetEntries(prog *Program, target Target) ([]funcEntry, []string, error) {
+	ourpkg, err := prog.LoadPackage(target.PkgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ret []funcEntry
+	for _, searchIdent := range target.Idents {
+		obj := ourpkg.Types.Scope().Lookup(searchIdent)
+		if !isFuncMapObject(obj) {
+			return nil, nil, &TargetNotFoundError{PkgPath: target.PkgPath, Var: searchIdent}
+		}
+		f := &flow{prog: prog, visited: map[string]bool{}}
+		entries, err := f.objectEntries(obj)
+		if e, ok := err.(*UnsupportedExprError); ok && e.Var == "" {
+			e.PkgPath = target.PkgPath
+			e.Var = searchIdent
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			e.TargetPkg = target.PkgPath
+			e.TargetVar = searchIdent
+			e.Builtin = target.Builtin
+			ret = append(ret, e)
+		}
+	}
+	return target.remap(ret)
+}
+
+// remap applies the filters, renames and prefix of the target
+// to the keys of its entries.
+// Two keys of a funcmap remapped to the same key are a KeyConflictError,
+// the warnings report the renamed keys that do not exist.
+func (t Target) remap(entries []funcEntry) ([]funcEntry, []string, error) {
+	var ret []funcEntry
+	var conflicts []Conflict
+	// the keys of a funcmap are unique before they are remapped,
+	// the same key set by several funcmaps is merged later.
+	index := map[string]int{}
+	found := map[string]bool{}
+	for _, e := range entries {
+		found[e.Key] = true
+		keep, err := t.keeps(e.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !keep {
+			continue
+		}
+		if name, ok := t.Renames[e.Key]; ok {
+			e.Key = name
+		} else {
+			e.Key = t.Prefix + e.Key
+		}
+		id := e.TargetVar + ":" + e.Key
+		if i, taken := index[id]; taken {
+			conflicts = append(conflicts, Conflict{
+				Key:    e.Key,
+				First:  entryOrigin(ret[i]),
+				Second: entryOrigin(e),
+			})
+			continue
+		}
+		index[id] = len(ret)
+		ret = append(ret, e)
+	}
+	if len(conflicts) > 0 {
+		return nil, nil, &KeyConflictError{Conflicts: conflicts}
+	}
+
+	var warnings []string
+	var renamed []string
+	for old := range t.Renames {
+		if !found[old] {
+			renamed = append(renamed, old)
+		}
+	}
+	sort.Strings(renamed)
+	for _, old := range renamed {
+		warnings = append(warnings, fmt.Sprintf(
+			"key %q renamed as %q is not a key of %v:%v",
+			old, t.Renames[old], t.PkgPath, strings.Join(t.Idents, ";"),
+		))
+	}
+	return ret, warnings, nil
+}
+
+// keeps tells if the key is matched by an include pattern of the target,
+// when there is any, and by none of its exclude patterns.
+func (t Target) keeps(key string) (bool, error) {
+	if len(t.Include) > 0 {
+		included, err := matchAnyKey(t.Include, key)
+		if !included || err != nil {
+			return false, err
+		}
+	}
+	excluded, err := matchAnyKey(t.Exclude, key)
+	return !excluded, err
+}
+
+// matchAnyKey tells if the key matches one of the patterns.
+func matchAnyKey(patterns []string, key string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := matchKey(pattern, key)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// matchKey tells if the key matches the pattern,
+// a glob such as html*,
+// or a regular expression between slashes such as /^_/.
+func matchKey(pattern, key string) (bool, error) {
+	var ok bool
+	var err error
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		ok, err = regexp.MatchString(pattern[1:len(pattern)-1], key)
+	} else {
+		ok, err = path.Match(pattern, key)
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid key pattern %q: %v", pattern, err)
+	}
+	return ok, nil
+}
+
+// collectEntries returns the entries of the funcmaps of every targets,
+// and the warnings of their remap,
+// targets without idents are expanded.
+func collectEntries(prog *Program, targets Targets) ([]funcEntry, []string, error) {
+	targets, _, err := targets.Expand(prog)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ret []funcEntry
+	var warnings []string
+	for _, target := range targets {
+		entries, w, err := targetEntries(prog, target)
+		if err != nil {
+			return nil, nil, err
+		}
+		ret = append(ret, entries...)
+		warnings = append(warnings, w...)
+	}
+	return ret, warnings, nil
+}
+
+// isFuncMapObject tells if obj is a funcmap variable,
+// or a function returning a funcmap.
+func isFuncMapObject(obj types.Object) bool {
+	switch o := obj.(type) {
+	case *types.Var:
+		return isFuncMapType(o.Type())
+	case *types.Func:
+		res := o.Type().(*types.Signature).Results()
+		return res.Len() > 0 && isFuncMapType(res.At(0).Type())
+	}
+	return false
+}
+
+func isFuncMapType(t types.Type) bool {
+	return isMapStringInterface(t) || isMapStringInterface(t.Underlying())
+}
+
+// flow follows the value flow of funcmaps
+// to find the keys assigned to them.
+type flow struct {
+	prog *Program
+	// visited holds the objects being analyzed,
+	// it prevents to loop over recursive declarations.
+	visited map[string]bool
+}
+
+// objectEntries returns the entries of a package level funcmap variable,
+// or the entries of the funcmap returned by a function.
+func (f *flow) objectEntries(obj types.Object) (funcEntries, error) {
+	id := obj.Pkg().Path() + "." + obj.Name()
+	if f.visited[id] {
+		return nil, nil
+	}
+	f.visited[id] = true
+	defer delete(f.visited, id)
+
+	// the object might come from another package,
+	// get it from its package loaded from source.
+	ourpkg, err := f.prog.LoadPackage(obj.Pkg().Path())
+	if err != nil {
+		return nil, err
+	}
+	name := obj.Name()
+	obj = ourpkg.Types.Scope().Lookup(name)
+	if obj == nil {
+		return nil, &TargetNotFoundError{PkgPath: ourpkg.PkgPath, Var: name}
+	}
+
+	var ret funcEntries
+	switch obj.(type) {
+	case *types.Var:
+		assigned := false
+		var initializers []ast.Node
+		for _, file := range ourpkg.Syntax {
+			for _, decl := range file.Decls {
+				if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.VAR {
+					for _, spec := range d.Specs {
+						spec := spec.(*ast.ValueSpec)
+						if declares(ourpkg, spec, obj) {
+							assigned = true
+							initializers = append(initializers, spec)
+						}
+						entries, err := f.specEntries(ourpkg, spec, obj, nil)
+						if err != nil {
+							return nil, err
+						}
+						for _, e := range entries {
+							ret.set(e)
+						}
+					}
+				}
+			}
+		}
+		// look for the mutations of the init funcs,
+		// the mutations of the other funcs are ignored,
+		// they might not run, or run after the funcmap is used.
+		initFuncs := initFuncDecls(ourpkg, initializers)
+		for _, file := range ourpkg.Syntax {
+			for _, decl := range file.Decls {
+				if d, ok := decl.(*ast.FuncDecl); ok && initFuncs[d] {
+					a, err := f.mutations(ourpkg, obj, d.Body, &ret)
+					if err != nil {
+						return nil, err
+					}
+					assigned = assigned || a
+				}
+			}
+		}
+		// a nil funcmap would be exported as an empty map.
+		if !assigned {
+			return nil, &UnsupportedExprError{
+				Expr:   obj.Name(),
+				Pos:    ourpkg.Fset.Position(obj.Pos()),
+				Reason: "is never assigned a funcmap",
+			}
+		}
+
+	case *types.Func:
+		decl := findFuncDecl(ourpkg, obj)
+		if decl == nil || decl.Body == nil {
+			return nil, fmt.Errorf("function %v has no body in %v", obj.Name(), ourpkg.PkgPath)
+		}
+		var walkErr error
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			if walkErr != nil {
+				return false
+			}
+			switch node := n.(type) {
+			case *ast.FuncLit:
+				return false // returns of closures do not matter.
+			case *ast.ReturnStmt:
+				if len(node.Results) > 0 {
+					entries, err := f.exprEntries(ourpkg, node.Results[0], decl.Body)
+					if err != nil {
+						walkErr = err
+						return false
+					}
+					for _, e := range entries {
+						ret.set(e)
+					}
+				}
+			}
+			return true
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+
+	return ret, nil
+}
+
+// specEntries returns the entries assigned to obj by the value spec.
+func (f *flow) specEntries(pkg *packages.Package, spec *ast.ValueSpec, obj types.Object, scope ast.Node) (funcEntries, error) {
+	for i, name := range spec.Names {
+		if pkg.TypesInfo.Defs[name] == obj && i < len(spec.Values) {
+			if len(spec.Values) != len(spec.Names) {
+				return nil, unsupportedExpr(pkg, spec.Values[0])
+			}
+			return f.exprEntries(pkg, spec.Values[i], scope)
+		}
+	}
+	return nil, nil
+}
+
+// initFuncDecls returns the declarations of the functions
+// that run at init time, the init funcs of pkg and the functions
+// of pkg they call, or called by the initializers, transitively.
+func initFuncDecls(pkg *packages.Package, initializers []ast.Node) map[*ast.FuncDecl]bool {
+	ret := map[*ast.FuncDecl]bool{}
+	var calls func(root ast.Node)
+	add := func(d *ast.FuncDecl) {
+		if d == nil || d.Body == nil || ret[d] {
+			return
+		}
+		ret[d] = true
+		calls(d.Body)
+	}
+	calls = func(root ast.Node) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if fn, ok := usedObject(pkg, call.Fun).(*types.Func); ok && fn.Pkg() == pkg.Types {
+					add(findFuncDecl(pkg, fn))
+				}
+			}
+			return true
+		})
+	}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == "init" {
+				add(d)
+			}
+		}
+	}
+	for _, n := range initializers {
+		calls(n)
+	}
+	return ret
+}
+
+// declares tells if the value spec assigns a value to obj.
+func declares(pkg *packages.Package, spec *ast.ValueSpec, obj types.Object) bool {
+	for _, name := range spec.Names {
+		if pkg.TypesInfo.Defs[name] == obj {
+			return len(spec.Values) > 0
+		}
+	}
+	return false
+}
+
+// exprEntries returns the entries of the funcmap expression.
+// scope is the function body where local variables are declared.
+func (f *flow) exprEntries(pkg *packages.Package, expr ast.Expr, scope ast.Node) (funcEntries, error) {
+	var ret funcEntries
+	switch node := expr.(type) {
+	case *ast.ParenExpr:
+		return f.exprEntries(pkg, node.X, scope)
+
+	case *ast.CompositeLit:
+		for _, elt := range node.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return nil, unsupportedExpr(pkg, elt)
+			}
+			key, err := entryKey(pkg, kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			ret.set(funcEntry{Key: key, Value: kv.Value, Pkg: pkg})
+		}
+		return ret, nil
+
+	case *ast.Ident, *ast.SelectorExpr:
+		obj := usedObject(pkg, node)
+		if v, ok := obj.(*types.Var); ok && !v.IsField() {
+			if v.Pkg() != nil && v.Parent() == v.Pkg().Scope() {
+				return f.objectEntries(v)
+			}
+			if scope != nil {
+				return f.localEntries(pkg, v, scope)
+			}
+		}
+
+	case *ast.CallExpr:
+		// a conversion such as template.FuncMap(m)
+		if tv, ok := pkg.TypesInfo.Types[node.Fun]; ok && tv.IsType() && len(node.Args) == 1 {
+			return f.exprEntries(pkg, node.Args[0], scope)
+		}
+		// an empty funcmap such as make(template.FuncMap),
+		// its mutations add the entries.
+		if b, ok := usedObject(pkg, node.Fun).(*types.Builtin); ok && b.Name() == "make" {
+			return ret, nil
+		}
+		// a call to a package level function.
+		fn, ok := usedObject(pkg, node.Fun).(*types.Func)
+		if ok && fn.Pkg() != nil && fn.Parent() == fn.Pkg().Scope() {
+			return f.objectEntries(fn)
+		}
+	}
+	return nil, unsupportedExpr(pkg, expr)
+}
+
+// localEntries returns the entries of a local funcmap variable,
+// its assignments are mutations.
+func (f *flow) localEntries(pkg *packages.Package, obj *types.Var, scope ast.Node) (funcEntries, error) {
+	var ret funcEntries
+	var walkErr error
+	ast.Inspect(scope, func(n ast.Node) bool {
+		if walkErr != nil {
+			return false
+		}
+		if node, ok := n.(*ast.ValueSpec); ok {
+			var entries funcEntries
+			entries, walkErr = f.specEntries(pkg, node, obj, scope)
+			for _, e := range entries {
+				ret.set(e)
+			}
+		}
+		return walkErr == nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if _, err := f.mutations(pkg, obj, scope, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// mutations updates entries with the mutations of obj
+// found into root, a function body, it tells if obj is assigned a value.
+// Mutations are m = other, which replaces the entries,
+// m["key"] = fn, delete(m, "key"), maps.Copy(m, other)
+// and for k, v := range other { m[k] = v }.
+func (f *flow) mutations(pkg *packages.Package, obj types.Object, root ast.Node, entries *funcEntries) (bool, error) {
+	assigned := false
+	var walkErr error
+	ast.Inspect(root, func(n ast.Node) bool {
+		if walkErr != nil {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.RangeStmt:
+			if src, ok := rangeCopy(pkg, obj, node); ok {
+				var merged funcEntries
+				merged, walkErr = f.exprEntries(pkg, src, root)
+				for _, e := range merged {
+					entries.set(e)
+				}
+				return false
+			}
+
+		case *ast.AssignStmt:
+			for i, lhs := range node.Lhs {
+				var index *ast.IndexExpr
+				switch l := lhs.(type) {
+				case *ast.Ident:
+					if usedObject(pkg, l) != obj {
+						continue
+					}
+				case *ast.IndexExpr:
+					if usedObject(pkg, l.X) != obj {
+						continue
+					}
+					index = l
+				default:
+					continue
+				}
+				if len(node.Rhs) != len(node.Lhs) {
+					walkErr = unsupportedExpr(pkg, node.Rhs[0])
+					return false
+				}
+				if index == nil {
+					var replaced funcEntries
+					replaced, walkErr = f.exprEntries(pkg, node.Rhs[i], root)
+					if walkErr != nil {
+						return false
+					}
+					*entries = replaced
+					assigned = true
+					continue
+				}
+				key, err := entryKey(pkg, index.Index)
+				if err != nil {
+					walkErr = err
+					return false
+				}
+				entries.set(funcEntry{Key: key, Value: node.Rhs[i], Pkg: pkg})
+			}
+
+		case *ast.CallExpr:
+			if len(node.Args) < 2 || usedObject(pkg, node.Args[0]) != obj {
+				break
+			}
+			switch fn := usedObject(pkg, node.Fun).(type) {
+			case *types.Builtin:
+				if fn.Name() == "delete" {
+					key, err := entryKey(pkg, node.Args[1])
+					if err != nil {
+						walkErr = err
+						return false
+					}
+					entries.del(key)
+				}
+			case *types.Func:
+				if fn.FullName() == "maps.Copy" {
+					var merged funcEntries
+					merged, walkErr = f.exprEntries(pkg, node.Args[1], root)
+					for _, e := range merged {
+						entries.set(e)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return assigned, walkErr
+}
+
+// rangeCopy tells if the range statement copies a map into obj,
+// such as for k, v := range other { m[k] = v },
+// it returns the ranged expression.
+func rangeCopy(pkg *packages.Package, obj types.Object, node *ast.RangeStmt) (ast.Expr, bool) {
+	if node.Key == nil || node.Value == nil || len(node.Body.List) != 1 {
+		return nil, false
+	}
+	assign, ok := node.Body.List[0].(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil, false
+	}
+	index, ok := assign.Lhs[0].(*ast.IndexExpr)
+	if !ok || usedObject(pkg, index.X) != obj {
+		return nil, false
+	}
+	k := usedObject(pkg, node.Key)
+	v := usedObject(pkg, node.Value)
+	if k == nil || k != usedObject(pkg, index.Index) || v == nil || v != usedObject(pkg, assign.Rhs[0]) {
+		return nil, false
+	}
+	return node.X, true
+}
+
+// usedObject returns the object an ident or a qualified ident refers to.
+func usedObject(pkg *packages.Package, expr ast.Expr) types.Object {
+	switch node := expr.(type) {
+	case *ast.ParenExpr:
+		return usedObject(pkg, node.X)
+	case *ast.Ident:
+		if obj := pkg.TypesInfo.Uses[node]; obj != nil {
+			return obj
+		}
+		return pkg.TypesInfo.Defs[node]
+	case *ast.SelectorExpr:
+		return pkg.TypesInfo.Uses[node.Sel]
+	}
+	return nil
+}
+
+// findFuncDecl returns the declaration of a package level function,
+// or of a method.
+func findFuncDecl(pkg *packages.Package, fn types.Object) *ast.FuncDecl {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && pkg.TypesInfo.Defs[d.Name] == fn {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// entryKey returns the string value of a funcmap key,
+// the key is a constant expression such as "upper", FnName or prefix + "upper".
+func entryKey(pkg *packages.Package, expr ast.Expr) (string, error) {
+	if tv, ok := pkg.TypesInfo.Types[expr]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value), nil
+	}
+	return "", &UnsupportedExprError{
+		Expr:   exprString(expr),
+		Pos:    pkg.Fset.Position(expr.Pos()),
+		Reason: "is not a constant string key",
+	}
+}
+
+func unsupportedExpr(pkg *packages.Package, expr ast.Expr) error {
+	return &UnsupportedExprError{
+		Expr: exprString(expr),
+		Pos:  pkg.Fset.Position(expr.Pos()),
+	}
+}
@@ -0,0 +1,117 @@
+package export_test
+
+import (
+	"testing"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+func TestFlow(t *testing.T) {
+
+	export.EnableCache = false
+
+	tpkg := "github.com/mh-cbon/export-funcmap/export/test"
+
+	datas := []testData{
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"madefn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/flow.go:10.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"madecallfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/flow.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"reassignedfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/flow.go:24.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"resetfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/flow.go:41.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"registeredfn"},
+			expectKeyCount: 0,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"helperfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/flow.go:62.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:       tpkg,
+			varnames:  []string{"unassignedfn"},
+			expectErr: true,
+		},
+		testData{
+			pkg:       tpkg,
+			varnames:  []string{"tuplefn"},
+			expectErr: true,
+		},
+	}
+
+	prog, err := export.GetProgram([]string{tpkg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range datas {
+		if !execTest(data, t, prog) {
+			break
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// AddImport registers the import of a package into file.Imports,
+// it returns the name the file must use to refer to the package.
+// When the package name is already used by another import,
+// the package is given an alias such as htmltemplate, or template2.
+func AddImport(file *ast.File, importPath, pkgName string) string {
+	if spec := getImportSpec(file, importPath); spec != nil {
+		return importSpecName(spec)
+	}
+
+	name := pkgName
+	if isImportNameTaken(file, name) {
+		// prefix the name with the parent directory, html/template => htmltemplate
+		parent := path.Base(path.Dir(importPath))
+		name = strings.Map(func(r rune) rune {
+			if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, parent) + pkgName
+		if !token.IsIdentifier(name) || isImportNameTaken(file, name) {
+			for i := 2; ; i++ {
+				name = fmt.Sprintf("%v%v", pkgName, i)
+				if !isImportNameTaken(file, name) {
+					break
+				}
+			}
+		}
+	}
+
+	alias := ""
+	if name != path.Base(importPath) {
+		alias = name
+	}
+	file.Imports = append(file.Imports, NewImportSpec(importPath, alias))
+	return name
+}
+
+// getImportSpec returns the import spec of importPath in file.Imports.
+func getImportSpec(file *ast.File, importPath string) *ast.ImportSpec {
+	for _, spec := range file.Imports {
+		if p, err := strconv.Unquote(spec.Path.Value); err == nil && p == importPath {
+			return spec
+		}
+	}
+	return nil
+}
+
+// importSpecName returns the name an import is referred with.
+func importSpecName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	p, _ := strconv.Unquote(spec.Path.Value)
+	return path.Base(p)
+}
+
+func isImportNameTaken(file *ast.File, name string) bool {
+	for _, spec := range file.Imports {
+		if importSpecName(spec) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Job is an export described in a jobs file.
+type Job struct {
+	// Out is the output filepath, relative to the jobs file.
+	Out string `json:"out" yaml:"out" toml:"out"`
+	// Package is the output package name.
+	Package string `json:"package" yaml:"package" toml:"package"`
+	// Var is the output variable name.
+	Var string `json:"var" yaml:"var" toml:"var"`
+	// Targets are pkgpath:var arguments, as given to the cli.
+	Targets []string `json:"targets" yaml:"targets" toml:"targets"`
+	// Split exports each funcmap variable into its own variable.
+	Split bool `json:"split" yaml:"split" toml:"split"`
+	// Unexported is the name of the unexported policy, error by default.
+	Unexported string `json:"unexported" yaml:"unexported" toml:"unexported"`
+	// Merge is the name of the merge policy, last by default.
+	Merge string `json:"merge" yaml:"merge" toml:"merge"`
+}
+
+// Jobs is a list of exports sharing one load of their packages.
+// The file sets every option of the exports,
+// the cli rejects the export options given along with it.
+type Jobs struct {
+	// Tags is a comma separated list of build tags
+	// used to load the packages of every jobs.
+	Tags string `json:"tags" yaml:"tags" toml:"tags"`
+	Jobs []Job  `json:"jobs" yaml:"jobs" toml:"jobs"`
+}
+
+// LoadJobs reads a jobs file,
+// it is decoded according to its extension, .json, .yaml, .yml or .toml.
+// Relative output filepaths are resolved against the directory of the jobs file.
+func LoadJobs(filename string) (*Jobs, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := &Jobs{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.Unmarshal(b, jobs)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, jobs)
+	case ".toml":
+		err = toml.Unmarshal(b, jobs)
+	default:
+		return nil, fmt.Errorf("unknown jobs file format %v", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %v", filename, err)
+	}
+
+	for i, job := range jobs.Jobs {
+		if job.Out == "" || job.Package == "" || job.Var == "" || len(job.Targets) == 0 {
+			return nil, fmt.Errorf("job %v of %v requires out, package, var and targets", i, filename)
+		}
+		if !filepath.IsAbs(job.Out) {
+			jobs.Jobs[i].Out = filepath.Join(filepath.Dir(filename), job.Out)
+		}
+	}
+	return jobs, nil
+}
+
+// Export exports every jobs,
+// the packages of all jobs are loaded at once into one program.
+// It returns the result of each job in order.
+func (j *Jobs) Export() ([]*Result, error) {
+	var buildFlags []string
+	if j.Tags != "" {
+		buildFlags = append(buildFlags, "-tags="+j.Tags)
+	}
+
+	confs := make([]Config, len(j.Jobs))
+	targets := make([]Targets, len(j.Jobs))
+	var all Targets
+	for i, job := range j.Jobs {
+		if err := targets[i].Parse(job.Targets); err != nil {
+			return nil, err
+		}
+		all = append(all, targets[i]...)
+
+		policy := UnexportedError
+		if job.Unexported != "" {
+			p, err := ParseUnexportedPolicy(job.Unexported)
+			if err != nil {
+				return nil, err
+			}
+			policy = p
+		}
+		merge := MergeLastWins
+		if job.Merge != "" {
+			p, err := ParseMergePolicy(job.Merge)
+			if err != nil {
+				return nil, err
+			}
+			merge = p
+		}
+		confs[i] = Config{BuildFlags: buildFlags, Split: job.Split, Unexported: policy, Merge: merge}
+	}
+
+	prog, err := GetProgram(all.GetPackagePaths(), buildFlags...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*Result
+	for i, job := range j.Jobs {
+		confs[i].Prog = prog
+		res, err := confs[i].Export(targets[i], job.Out, job.Package, job.Var)
+		if err != nil {
+			return nil, fmt.Errorf("job %v: %w", job.Out, err)
+		}
+		ret = append(ret, res)
+	}
+	return ret, nil
+}
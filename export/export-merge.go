@@ -0,0 +1,134 @@
+package export
+
+import (
+	"fmt"
+	"go/token"
+)
+
+// MergePolicy tells how to merge a key set by several funcmaps
+// exported into the same variable.
+type MergePolicy int
+
+const (
+	// MergeLastWins keeps the value of the last funcmap,
+	// at the position of the first one.
+	MergeLastWins MergePolicy = iota
+	// MergeFirstWins keeps the value of the first funcmap.
+	MergeFirstWins
+	// MergeError fails the export with a KeyConflictError.
+	MergeError
+	// MergePrefix keeps the value of the first funcmap,
+	// the values of the next funcmaps are given a key prefixed
+	// by their variable name, such as k2_dup,
+	// or by their package and variable names when it is taken too,
+	// followed by a number when it is still taken.
+	MergePrefix
+)
+
+var mergePolicyNames = map[MergePolicy]string{
+	MergeLastWins:  "last",
+	MergeFirstWins: "first",
+	MergeError:     "error",
+	MergePrefix:    "prefix",
+}
+
+func (p MergePolicy) String() string {
+	return mergePolicyNames[p]
+}
+
+// ParseMergePolicy returns the policy of given name,
+// one of last, first, error or prefix.
+func ParseMergePolicy(s string) (MergePolicy, error) {
+	for p, name := range mergePolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return MergeLastWins, fmt.Errorf("Invalid merge policy: %v", s)
+}
+
+// Origin is the funcmap setting a key.
+type Origin struct {
+	PkgPath string `json:"pkgPath"`
+	Var     string `json:"var"`
+	// Pos is the position of the value of the key.
+	Pos token.Position `json:"pos"`
+}
+
+func (o Origin) String() string {
+	return fmt.Sprintf("%v:%v at %v", o.PkgPath, o.Var, o.Pos)
+}
+
+// Conflict is a key set by two funcmaps.
+type Conflict struct {
+	Key string `json:"key"`
+	// First and Second are the funcmaps setting the key, in order.
+	First  Origin `json:"first"`
+	Second Origin `json:"second"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("key %q of %v conflicts with %v", c.Key, c.Second, c.First)
+}
+
+func entryOrigin(e funcEntry) Origin {
+	return Origin{PkgPath: e.TargetPkg, Var: e.TargetVar, Pos: e.Position()}
+}
+
+// mergeEntries merges the entries of several funcmaps according to policy,
+// it returns the merged entries and the conflicts found.
+// A funcmap targeted twice does not conflict with itself,
+// nor two funcmaps setting the same value, such as a copied funcmap.
+func mergeEntries(prog *Program, entries []funcEntry, policy MergePolicy) ([]funcEntry, []Conflict, error) {
+	var ret []funcEntry
+	var conflicts []Conflict
+	index := map[string]int{}
+
+	for _, e := range entries {
+		i, ok := index[e.Key]
+		if !ok {
+			index[e.Key] = len(ret)
+			ret = append(ret, e)
+			continue
+		}
+		prev := ret[i]
+		if prev.TargetPkg == e.TargetPkg && prev.TargetVar == e.TargetVar {
+			ret[i] = e
+			continue
+		}
+		if prev.Position() == e.Position() {
+			continue
+		}
+
+		conflicts = append(conflicts, Conflict{
+			Key:    e.Key,
+			First:  entryOrigin(prev),
+			Second: entryOrigin(e),
+		})
+
+		switch policy {
+		case MergeLastWins:
+			ret[i] = e
+		case MergePrefix:
+			e.Key = e.TargetVar + "_" + e.Key
+			if _, taken := index[e.Key]; taken {
+				pkgName := prog.Package(e.TargetPkg).Types.Name()
+				e.Key = pkgName + "_" + e.Key
+			}
+			key := e.Key
+			for n := 2; ; n++ {
+				if _, taken := index[e.Key]; !taken {
+					break
+				}
+				e.Key = fmt.Sprintf("%v_%v", key, n)
+			}
+			index[e.Key] = len(ret)
+			ret = append(ret, e)
+		}
+	}
+
+	if policy == MergeError && len(conflicts) > 0 {
+		return nil, nil, &KeyConflictError{Conflicts: conflicts}
+	}
+	return ret, conflicts, nil
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Program is a set of packages loaded
+// with their syntax and type information.
+type Program struct {
+	Fset *token.FileSet
+	// Roots are the packages matching the loaded patterns.
+	Roots      []*packages.Package
+	pkgs       map[string]*packages.Package
+	buildFlags []string
+}
+
+// Package returns the loaded package of given import path,
+// it returns nil when the package was not loaded.
+func (p *Program) Package(importPath string) *packages.Package {
+	return p.pkgs[importPath]
+}
+
+// loadMode is the information needed to export a funcmap.
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedImports |
+	packages.NeedTypes |
+	packages.NeedSyntax |
+	packages.NeedTypesInfo |
+	packages.NeedModule
+
+// GetProgram creates a new Program of a list of packages.
+// Packages are loaded by the go command,
+// thus go.mod, go.work, vendor directories and GOFLAGS are respected.
+// buildFlags are passed to the go command, for example -tags=xx.
+func GetProgram(pkgs []string, buildFlags ...string) (*Program, error) {
+
+	prog := &Program{
+		Fset:       token.NewFileSet(),
+		pkgs:       map[string]*packages.Package{},
+		buildFlags: buildFlags,
+	}
+
+	roots, err := prog.load(pkgs...)
+	if err != nil {
+		return nil, err
+	}
+	prog.Roots = roots
+
+	return prog, nil
+}
+
+// load loads the packages into the program.
+func (p *Program) load(pkgs ...string) ([]*packages.Package, error) {
+	conf := &packages.Config{
+		Mode:       loadMode,
+		BuildFlags: p.buildFlags,
+		Fset:       p.Fset,
+	}
+	roots, err := packages.Load(conf, pkgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	packages.Visit(roots, nil, func(pkg *packages.Package) {
+		// dependencies are loaded without their syntax,
+		// do not let them hide a package loaded from source.
+		if prev := p.pkgs[pkg.PkgPath]; prev == nil || prev.TypesInfo == nil {
+			p.pkgs[pkg.PkgPath] = pkg
+		}
+		for _, e := range pkg.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load packages\n%v", strings.Join(errs, "\n"))
+	}
+
+	return roots, nil
+}
+
+// LoadPackage returns the package of given import path
+// with its syntax and type information,
+// the package is loaded when the program does not have it yet.
+func (p *Program) LoadPackage(importPath string) (*packages.Package, error) {
+	if pkg := p.Package(importPath); pkg == nil || pkg.TypesInfo == nil {
+		if _, err := p.load(importPath); err != nil {
+			return nil, err
+		}
+	}
+	return getPackage(p, importPath)
+}
+
+// getPackage returns the loaded package of given import path.
+func getPackage(prog *Program, importPath string) (*packages.Package, error) {
+	p := prog.Package(importPath)
+	if p == nil || p.Types == nil || p.TypesInfo == nil {
+		return nil, fmt.Errorf("package %v not loaded", importPath)
+	}
+	return p, nil
+}
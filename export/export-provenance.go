@@ -0,0 +1,131 @@
+package export
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// provenance returns the lines of the comment telling
+// where the function of an entry comes from, such as
+//
+//	"html" is HTMLEscaper of text/template, at text/template/funcs.go:649.
+//
+//	HTMLEscaper returns the escaped HTML equivalent of the textual
+//	representation of its arguments.
+func provenance(prog *Program, entry funcEntry) []string {
+	expr := "a func literal"
+	if _, ok := entry.Value.(*ast.FuncLit); !ok {
+		src, err := astNodeToString(entry.Value)
+		if err != nil || strings.Contains(src, "\n") {
+			src = "an expression"
+		}
+		expr = src
+	}
+
+	pkgPath := entry.Pkg.PkgPath
+	pos := shortPosition(pkgPath, entry.Position())
+	var doc string
+	obj := usedObject(entry.Pkg, genericFunc(entry.Pkg, entry.Value))
+	if obj != nil && isPackageLevel(obj) {
+		pkgPath = obj.Pkg().Path()
+		pos = objectPosition(entry.Pkg.Fset, obj)
+		if fn, ok := obj.(*types.Func); ok {
+			doc = funcDoc(prog, fn)
+		}
+	} else {
+		obj = nil
+	}
+
+	line := fmt.Sprintf("%q is %v of %v", entry.Key, expr, pkgPath)
+	if obj == nil {
+		// the position tells the package of a func literal.
+		line = fmt.Sprintf("%q is %v", entry.Key, expr)
+	}
+	if pos != "" {
+		line += ", at " + pos
+	}
+	lines := []string{line + "."}
+	if doc != "" {
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(strings.TrimSpace(doc), "\n")...)
+	}
+	return lines
+}
+
+// isPackageLevel tells if an object is declared at the package level,
+// methods and local variables are not.
+func isPackageLevel(obj types.Object) bool {
+	return obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+}
+
+// loadFuncPackages loads from source, in one load, the packages
+// declaring the package level functions of entries,
+// so that their docs and positions do not load them one by one.
+// A package failing to load is left to funcDoc and sourceObject.
+func loadFuncPackages(prog *Program, entries []funcEntry) {
+	var paths []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		obj := usedObject(entry.Pkg, genericFunc(entry.Pkg, entry.Value))
+		if obj == nil || !isPackageLevel(obj) {
+			continue
+		}
+		path := obj.Pkg().Path()
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if pkg := prog.Package(path); pkg == nil || pkg.TypesInfo == nil {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		prog.load(paths...)
+	}
+}
+
+// sourceObject returns the object of the package loaded from source
+// declared as obj, a package level object of a dependency
+// carries the position recorded by its export data,
+// such as $GOROOT/src/strings/strings.go.
+// It returns obj when its package fails to load.
+func sourceObject(prog *Program, obj types.Object) types.Object {
+	pkg, err := prog.LoadPackage(obj.Pkg().Path())
+	if err != nil {
+		return obj
+	}
+	if o := pkg.Types.Scope().Lookup(obj.Name()); o != nil {
+		return o
+	}
+	return obj
+}
+
+// funcDoc returns the doc comment of a package level function,
+// its package is loaded from source when needed.
+func funcDoc(prog *Program, fn *types.Func) string {
+	pkg, err := prog.LoadPackage(fn.Pkg().Path())
+	if err != nil {
+		return ""
+	}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == fn.Name() {
+				return d.Doc.Text()
+			}
+		}
+	}
+	return ""
+}
+
+// shortPosition returns a position relative to its package,
+// such as text/template/funcs.go:755.
+func shortPosition(pkgPath string, pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%v/%v:%v", pkgPath, filepath.Base(pos.Filename), pos.Line)
+}
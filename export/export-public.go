@@ -5,124 +5,165 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"path/filepath"
+	"go/types"
+	"strconv"
 	"strings"
 
-	"golang.org/x/tools/go/loader"
+	"github.com/mh-cbon/export-funcmap/funcinfo"
+	"golang.org/x/tools/go/packages"
 )
 
 // PublicIdents exports
-// a map of pkg import path and function ident
+// the package level function information
 // for every values of the target funcMap defined
 // as an ident or a selector expression.
 // For a funcmap defined such
 // package y
-// var x := map[string]interface{}{
-//  "f1": template.HTMLEscaper,
-//  "f2": PublicFunc,
-// }
+//
+//	var x := map[string]interface{}{
+//	 "f1": template.HTMLEscaper,
+//	 "f2": PublicFunc,
+//	}
+//
 // PublicIdents exports their information
-// var yy = []map[string][string]{
-//  map[string]string{
-//   "FuncName": "f1",
-//   "Sel": "template.HTMLEscaper",
-//   "Pkg": "html/template",
-//  },
-//   "FuncName": "f2",
-//   "Sel": "y.PublicFunc",
-//   "Pkg": "some/package/path",
-//  },
-//}
-func PublicIdents(targetPackagePaths Targets, outvarname string, prog *loader.Program, destFile *ast.File) (ast.Decl, error) {
-
-	var err error
-	var res []map[string]string
-
-	for _, targetPackagePath := range targetPackagePaths {
-
-		ourpkg := prog.Package(targetPackagePath.PkgPath)
-
-		for _, searchIdent := range targetPackagePath.Idents {
-			found := false
-			for id := range findMapStringInterface(ourpkg.Pkg, ourpkg.Defs) {
-				if id.Name == searchIdent {
-					if valueSpec, ok := id.Obj.Decl.(*ast.ValueSpec); ok {
-						found = true
-						if len(valueSpec.Values) > 0 {
-							keyValues := valueSpec.Values[0].(*ast.CompositeLit).Elts
-							for _, e := range keyValues {
-								expr := e.(*ast.KeyValueExpr).Value
-								key := e.(*ast.KeyValueExpr).Key.(*ast.BasicLit)
-								switch node := expr.(type) {
-								case *ast.Ident:
-									if ast.IsExported(node.Name) {
-										res = append(res, map[string]string{
-											"FuncName": key.Value[1 : len(key.Value)-1], // remove quotes
-											"Sel":      ourpkg.Pkg.Name() + "." + node.Name,
-											"Pkg":      ourpkg.Pkg.Path(),
-										})
-									}
-								case *ast.SelectorExpr:
-									if ast.IsExported(node.Sel.Name) {
-
-										pkgg := ourpkg.Uses[node.X.(*ast.Ident)]
-										// dirty way :x
-										// str will look like
-										// package alias ("html/template")
-										// or
-										// package fmt
-										str := pkgg.String()
-										str = str[8:] // get ride of package
-										if strings.Index(str, " ") > -1 {
-											str = strings.Split(str, " ")[1]
-											str = str[2 : len(str)-2] // get ride of parenthesis and quotes
-										}
-										importPath := str
-										pkgName := filepath.Base(importPath)
-
-										res = append(res, map[string]string{
-											"FuncName": key.Value[1 : len(key.Value)-1], // remove quotes
-											"Sel":      pkgName + "." + node.Sel.Name,
-											"Pkg":      importPath,
-										})
-									}
-								case *ast.FuncLit:
-									//pass
-								default:
-									panic(
-										fmt.Errorf("export.PublicIdents: unhandled ast node type %v\n%#v",
-											node, node),
-									)
-								}
-							}
-						}
-					}
-				}
-			}
-			if found == false {
-				return nil, fmt.Errorf(
-					"variable %v not found in %v",
-					searchIdent,
-					targetPackagePath.PkgPath,
-				)
-			}
+//
+//	var yy = []funcinfo.FuncInfo{
+//		{FuncName: "f1", Sel: "template.HTMLEscaper", Pkg: "html/template", PkgName: "template", Signature: "func(args ...interface{}) string", Pos: "html/template/escape.go:..."},
+//		{FuncName: "f2", Sel: "y.PublicFunc", Pkg: "some/package/path", ...},
+//	}
+//
+// The signatures are rendered with the unexported policy of the symbolic map.
+// It returns the import paths the declaration uses.
+func PublicIdents(targetPackagePaths Targets, outvarname string, prog *Program, destFile *ast.File) (ast.Decl, []string, error) {
+	entries, _, err := collectEntries(prog, targetPackagePaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &typeRenderer{file: destFile}
+	decl, err := publicIdentsDecl(entries, outvarname, r)
+	return decl, r.imported, err
+}
+
+// funcInfoPkg is the import path of the package defining FuncInfo.
+const funcInfoPkg = "github.com/mh-cbon/export-funcmap/funcinfo"
+
+// publicIdentsDecl declares the public idents of the entries
+// as a slice of funcinfo.FuncInfo.
+func publicIdentsDecl(entries []funcEntry, outvarname string, r *typeRenderer) (ast.Decl, error) {
+
+	var infos []funcinfo.FuncInfo
+
+	for _, entry := range entries {
+		// values such as func literals and calls have no public identifier.
+		obj := publicFunc(entry)
+		if obj == nil {
+			continue
+		}
+		signature, err := entry.Signature()
+		if err != nil {
+			return nil, err
 		}
+		// the signature of the symbolic funcmap.
+		rendered, err := r.policyType(signature)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, funcinfo.FuncInfo{
+			FuncName:  entry.Key,
+			Sel:       obj.Pkg().Name() + "." + obj.Name(),
+			Pkg:       obj.Pkg().Path(),
+			PkgName:   obj.Pkg().Name(),
+			Signature: types.TypeString(rendered, packageName),
+			Pos:       objectPosition(entry.Pkg.Fset, obj),
+		})
 	}
 
-	gocode := `package y
-  var ` + outvarname + ` []map[string]string = ` + fmt.Sprintf("%#v", res)
-	astNode := stringToAst(gocode)
+	return funcInfosDecl(infos, outvarname, r)
+}
+
+// funcInfosDecl declares infos as a slice of funcinfo.FuncInfo,
+// one element per line.
+func funcInfosDecl(infos []funcinfo.FuncInfo, outvarname string, r *typeRenderer) (ast.Decl, error) {
+
+	// write the declaration as source, var xx = []funcinfo.FuncInfo{...},
+	// so that its elements are positioned on their own line when it is parsed.
+	name := r.importName(funcInfoPkg, "funcinfo")
+	var b strings.Builder
+	b.WriteString("package y\n\nvar " + outvarname + " = []" + name + ".FuncInfo{\n")
+	for _, info := range infos {
+		fields := []ast.Expr{
+			newStringField("FuncName", info.FuncName),
+			newStringField("Sel", info.Sel),
+			newStringField("Pkg", info.Pkg),
+			newStringField("PkgName", info.PkgName),
+			newStringField("Signature", info.Signature),
+			newStringField("Pos", info.Pos),
+		}
+		elt, err := astNodeToString(&ast.CompositeLit{Elts: fields})
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("\t" + elt + ",\n")
+	}
+	b.WriteString("}\n")
 
-	return astNode.Decls[0], err
+	f, err := stringToAst(b.String())
+	if err != nil {
+		return nil, err
+	}
+	return f.Decls[0], nil
+}
+
+// newStringField returns a key value of a struct literal, Key: "value".
+func newStringField(key, value string) *ast.KeyValueExpr {
+	return &ast.KeyValueExpr{
+		Key:   ast.NewIdent(key),
+		Value: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(value)},
+	}
+}
+
+// objectPosition returns the position of the declaration of obj
+// relative to its package, such as text/template/funcs.go:755.
+func objectPosition(fset *token.FileSet, obj types.Object) string {
+	return shortPosition(obj.Pkg().Path(), fset.Position(obj.Pos()))
+}
+
+// publicFunc returns the exported package level object
+// the entry value refers to, it returns nil for other values,
+// such as local variables, method values and func literals.
+func publicFunc(entry funcEntry) types.Object {
+	obj := usedObject(entry.Pkg, genericFunc(entry.Pkg, entry.Value))
+	if obj != nil && obj.Exported() && obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+		return obj
+	}
+	return nil
+}
+
+// genericFunc returns the generic function of an instantiation,
+// such as maps.Keys for maps.Keys[map[string]int],
+// other expressions are returned unchanged.
+func genericFunc(pkg *packages.Package, expr ast.Expr) ast.Expr {
+	var x ast.Expr
+	switch node := expr.(type) {
+	case *ast.IndexExpr:
+		x = node.X
+	case *ast.IndexListExpr:
+		x = node.X
+	default:
+		return expr
+	}
+	if s, ok := pkg.TypesInfo.TypeOf(x).(*types.Signature); ok && s.TypeParams().Len() > 0 {
+		return x
+	}
+	return expr
 }
 
-func stringToAst(gocode string) *ast.File {
-	f, err := parser.ParseFile(token.NewFileSet(), "", gocode, 0)
+func stringToAst(gocode string) (*ast.File, error) {
+	f, err := parser.ParseFile(generatedFset, "", gocode, parser.ParseComments)
 	if err != nil {
-		err := fmt.Errorf(
-			"stringToAst: Failed to convert string to ast\n%v",
-			gocode)
-		panic(err)
+		return nil, fmt.Errorf(
+			"stringToAst: Failed to convert string to ast: %v\n%v",
+			err, gocode)
 	}
-	return f
+	return f, nil
 }
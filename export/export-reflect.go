@@ -0,0 +1,497 @@
+package export
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mh-cbon/export-funcmap/funcinfo"
+	"golang.org/x/tools/go/packages"
+)
+
+// FromFuncMap exports symbolic and public idents information
+// of a funcmap assembled at runtime, such as
+//
+//	FromFuncMap(map[string]interface{}(template.FuncMap{...}), "gen.go", "gen", "funcs")
+//
+// The signatures are derived from the reflect types of the values.
+func FromFuncMap(funcs map[string]interface{}, outfilename, outpackage, outvarname string) (*ast.File, error) {
+	res, err := Config{}.FromFuncMap(funcs, outfilename, outpackage, outvarname)
+	if err != nil {
+		return nil, err
+	}
+	return res.File, nil
+}
+
+// FromFuncMap exports symbolic and public idents information
+// of a funcmap assembled at runtime, its keys are exported in order.
+// Reflection does not tell the names of the parameters,
+// they are named arg0, arg1...
+// The Unexported policy applies, the interface policy considers
+// the interfaces met in the signatures of the funcmap only.
+// BuildFlags, Split, Merge and Prog do not apply.
+// The names of the packages of the public functions are loaded
+// with the go command, the functions and the types of package main
+// are not supported as it can not be imported.
+func (c Config) FromFuncMap(funcs map[string]interface{}, outfilename, outpackage, outvarname string) (*Result, error) {
+
+	// create a new file of a package.
+	_, destFile := NewPkg(outfilename, outpackage)
+	res := &Result{File: destFile}
+	r := &typeRenderer{file: destFile, unexported: c.Unexported}
+	conv := &reflectConverter{
+		pkgs:  map[string]*types.Package{},
+		named: map[reflect.Type]*types.Named{},
+	}
+
+	keys := make([]string, 0, len(funcs))
+	for key := range funcs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// write the declaration as source, as symbolicDecl does.
+	var b strings.Builder
+	b.WriteString("package y\n\nvar " + outvarname + " = map[string]interface{}{\n")
+	var infos []funcinfo.FuncInfo
+
+	for _, key := range keys {
+		v := reflect.ValueOf(funcs[key])
+		if v.Kind() != reflect.Func || v.IsNil() {
+			return nil, &UnsupportedExprError{
+				Key:    key,
+				Expr:   fmt.Sprintf("%T", funcs[key]),
+				Reason: "is not a function",
+			}
+		}
+		fn := runtimeFunc(v)
+		if fn.Public && fn.PkgPath == "main" {
+			return nil, &UnsupportedTypeError{Key: key, Pos: fn.Pos, Err: fmt.Errorf(
+				"Cannot refer to %v, package main can not be imported", fn.Name,
+			)}
+		}
+
+		t, err := conv.convert(v.Type())
+		if err != nil {
+			return nil, &UnsupportedTypeError{Key: key, Pos: fn.Pos, Err: err}
+		}
+		signature := t.(*types.Signature)
+
+		lit, err := r.newFuncLit(signature)
+		if err == errSkip {
+			r.warnings = append(r.warnings, fmt.Sprintf(
+				"skipped key %q, its signature uses an unexported type", key,
+			))
+			continue
+		} else if err != nil {
+			return nil, &UnsupportedTypeError{Key: key, Pos: fn.Pos, Err: err}
+		}
+
+		pos := shortPosition(fn.PkgPath, fn.Pos)
+		line := fmt.Sprintf("%q is %v", key, fn.Name)
+		if pos != "" {
+			line += ", at " + pos
+		}
+		b.WriteString("\t// " + line + ".\n")
+		src, err := astNodeToString(lit)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("\t" + strconv.Quote(key) + ": " + src + ",\n")
+
+		if fn.Public {
+			rendered, err := r.policyType(signature)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, funcinfo.FuncInfo{
+				FuncName:  key,
+				Sel:       fn.Ident,
+				Pkg:       fn.PkgPath,
+				Signature: types.TypeString(rendered, packageName),
+				Pos:       pos,
+			})
+		}
+	}
+	b.WriteString("}\n")
+
+	// the runtime names tell the package paths, not the package names.
+	names, err := conv.packageNames(infos)
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		infos[i].PkgName = names[infos[i].Pkg]
+		infos[i].Sel = infos[i].PkgName + "." + infos[i].Sel
+	}
+
+	f, err := stringToAst(b.String())
+	if err != nil {
+		return nil, err
+	}
+	destFile.Comments = append(destFile.Comments, f.Comments...)
+
+	publicIdents, err := funcInfosDecl(infos, outvarname+"Public", r)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Warnings = r.warnings
+
+	// create and inject the import statement
+	AddImportDecl(destFile, r.imported)
+
+	// add the new vars to the file.
+	destFile.Decls = append(destFile.Decls, f.Decls[0], publicIdents)
+
+	return res, nil
+}
+
+// reflectFunc describes a function value found at runtime.
+type reflectFunc struct {
+	// Name is the runtime name of the function,
+	// such as html/template.HTMLEscaper or main.main.func1.
+	Name string
+	// PkgPath and Ident are set when the function
+	// is declared at the package level.
+	PkgPath string
+	Ident   string
+	// Public tells the function is exported at the package level.
+	Public bool
+	Pos    token.Position
+}
+
+// runtimeFunc describes the function of a func value.
+func runtimeFunc(v reflect.Value) reflectFunc {
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return reflectFunc{Name: "a func value"}
+	}
+	ret := reflectFunc{Name: f.Name()}
+	file, line := f.FileLine(f.Entry())
+	ret.Pos = token.Position{Filename: file, Line: line}
+
+	// the package path ends at the first dot following the last slash,
+	// github.com/acme/app/views.Upper, the dots of its last element
+	// are escaped, gopkg.in/yaml%2ev3.Marshal
+	slash := strings.LastIndex(ret.Name, "/")
+	dot := strings.Index(ret.Name[slash+1:], ".")
+	if dot < 0 {
+		return ret
+	}
+	ret.PkgPath = ret.Name[:slash+1+dot]
+	if p, err := url.PathUnescape(ret.PkgPath); err == nil {
+		ret.PkgPath = p
+	}
+	ret.Ident = ret.Name[slash+1+dot+1:]
+	ret.Name = ret.PkgPath + "." + ret.Ident
+
+	// closures, methods and instantiations are named
+	// main.main.func1, pkg.(*T).Method-fm or pkg.Keys[...].
+	ret.Public = token.IsExported(ret.Ident) && !strings.ContainsAny(ret.Ident, ".([-")
+	return ret
+}
+
+// reflectConverter converts reflect types to go/types types,
+// the named types are declared into packages made on the fly.
+type reflectConverter struct {
+	pkgs  map[string]*types.Package
+	named map[reflect.Type]*types.Named
+	// order lists the named types in the order they were made,
+	// the first declared ones are in the scope of their package.
+	order    []reflect.Type
+	declared int
+}
+
+// convert returns the types.Type of t,
+// on failure the named types made meanwhile are dropped.
+// The named types converted are declared in their package.
+func (c *reflectConverter) convert(t reflect.Type) (types.Type, error) {
+	n := len(c.order)
+	ret, err := c.typeOf(t)
+	if err != nil {
+		c.rollback(n)
+		return nil, err
+	}
+	for _, t := range c.order[c.declared:] {
+		obj := c.named[t].Obj()
+		obj.Pkg().Scope().Insert(obj)
+	}
+	c.declared = len(c.order)
+	return ret, nil
+}
+
+// rollback drops the named types made after the n first ones.
+func (c *reflectConverter) rollback(n int) {
+	for _, t := range c.order[n:] {
+		delete(c.named, t)
+	}
+	c.order = c.order[:n]
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// typeOf returns the types.Type of t.
+func (c *reflectConverter) typeOf(t reflect.Type) (types.Type, error) {
+	if t == errorType {
+		return types.Universe.Lookup("error").Type(), nil
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return c.namedOf(t)
+	}
+	return c.underlyingOf(t)
+}
+
+// namedOf returns the named type of t,
+// along with its methods.
+func (c *reflectConverter) namedOf(t reflect.Type) (types.Type, error) {
+	if n, ok := c.named[t]; ok {
+		return n, nil
+	}
+	if strings.Contains(t.Name(), "[") {
+		return nil, fmt.Errorf("Cannot convert the instantiated generic type %v", t)
+	}
+
+	if t.PkgPath() == "main" {
+		return nil, fmt.Errorf("Cannot convert the type %v, package main can not be imported", t)
+	}
+
+	pkg := c.pkgs[t.PkgPath()]
+	if pkg == nil {
+		// template.Template is named after its package name.
+		name := strings.TrimSuffix(t.String(), "."+t.Name())
+		pkg = types.NewPackage(t.PkgPath(), name)
+		c.pkgs[t.PkgPath()] = pkg
+	}
+	obj := types.NewTypeName(token.NoPos, pkg, t.Name(), nil)
+	n := types.NewNamed(obj, nil, nil)
+	// register it before its underlying type that may refer to it.
+	c.named[t] = n
+	c.order = append(c.order, t)
+
+	u, err := c.underlyingOf(t)
+	if err != nil {
+		return nil, err
+	}
+	n.SetUnderlying(u)
+
+	if t.Kind() == reflect.Interface {
+		return n, nil
+	}
+	// the methods let the interface policy find the interfaces t implements,
+	// those that can not be converted are left out.
+	for _, recv := range []reflect.Type{t, reflect.PointerTo(t)} {
+		for i := 0; i < recv.NumMethod(); i++ {
+			m := recv.Method(i)
+			if recv != t {
+				if _, ok := t.MethodByName(m.Name); ok {
+					continue
+				}
+			}
+			recvType := types.Type(n)
+			if recv != t {
+				recvType = types.NewPointer(n)
+			}
+			before := len(c.order)
+			sig, err := c.signatureOf(m.Type, types.NewVar(token.NoPos, pkg, "", recvType), 1)
+			if err != nil {
+				c.rollback(before)
+				continue
+			}
+			n.AddMethod(types.NewFunc(token.NoPos, pkg, m.Name, sig))
+		}
+	}
+	return n, nil
+}
+
+// underlyingOf returns the type of t regardless of its name.
+func (c *reflectConverter) underlyingOf(t reflect.Type) (types.Type, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return types.Typ[types.Bool], nil
+	case reflect.Int:
+		return types.Typ[types.Int], nil
+	case reflect.Int8:
+		return types.Typ[types.Int8], nil
+	case reflect.Int16:
+		return types.Typ[types.Int16], nil
+	case reflect.Int32:
+		return types.Typ[types.Int32], nil
+	case reflect.Int64:
+		return types.Typ[types.Int64], nil
+	case reflect.Uint:
+		return types.Typ[types.Uint], nil
+	case reflect.Uint8:
+		return types.Typ[types.Uint8], nil
+	case reflect.Uint16:
+		return types.Typ[types.Uint16], nil
+	case reflect.Uint32:
+		return types.Typ[types.Uint32], nil
+	case reflect.Uint64:
+		return types.Typ[types.Uint64], nil
+	case reflect.Uintptr:
+		return types.Typ[types.Uintptr], nil
+	case reflect.Float32:
+		return types.Typ[types.Float32], nil
+	case reflect.Float64:
+		return types.Typ[types.Float64], nil
+	case reflect.Complex64:
+		return types.Typ[types.Complex64], nil
+	case reflect.Complex128:
+		return types.Typ[types.Complex128], nil
+	case reflect.String:
+		return types.Typ[types.String], nil
+	case reflect.UnsafePointer:
+		return types.Typ[types.UnsafePointer], nil
+
+	case reflect.Array:
+		elem, err := c.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return types.NewArray(elem, int64(t.Len())), nil
+
+	case reflect.Slice:
+		elem, err := c.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return types.NewSlice(elem), nil
+
+	case reflect.Pointer:
+		elem, err := c.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return types.NewPointer(elem), nil
+
+	case reflect.Map:
+		key, err := c.typeOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := c.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return types.NewMap(key, elem), nil
+
+	case reflect.Chan:
+		elem, err := c.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		dir := types.SendRecv
+		switch t.ChanDir() {
+		case reflect.SendDir:
+			dir = types.SendOnly
+		case reflect.RecvDir:
+			dir = types.RecvOnly
+		}
+		return types.NewChan(dir, elem), nil
+
+	case reflect.Func:
+		return c.signatureOf(t, nil, 0)
+
+	case reflect.Struct:
+		var fields []*types.Var
+		var tags []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			ft, err := c.typeOf(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, types.NewField(token.NoPos, c.pkgOf(f.PkgPath), f.Name, ft, f.Anonymous))
+			tags = append(tags, string(f.Tag))
+		}
+		return types.NewStruct(fields, tags), nil
+
+	case reflect.Interface:
+		var methods []*types.Func
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			sig, err := c.signatureOf(m.Type, nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, types.NewFunc(token.NoPos, c.pkgOf(m.PkgPath), m.Name, sig))
+		}
+		return types.NewInterfaceType(methods, nil).Complete(), nil
+	}
+	return nil, fmt.Errorf("Cannot convert the type %v", t)
+}
+
+// signatureOf returns the signature of the func type t,
+// the first skip parameters are left out, such as the receiver of a method.
+func (c *reflectConverter) signatureOf(t reflect.Type, recv *types.Var, skip int) (*types.Signature, error) {
+	var params, results []*types.Var
+	for i := skip; i < t.NumIn(); i++ {
+		pt, err := c.typeOf(t.In(i))
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, types.NewParam(token.NoPos, nil, "", pt))
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		rt, err := c.typeOf(t.Out(i))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewParam(token.NoPos, nil, "", rt))
+	}
+	return types.NewSignatureType(recv, nil, nil, types.NewTuple(params...), types.NewTuple(results...), t.IsVariadic()), nil
+}
+
+// packageNames returns the names of the packages of infos, by path,
+// the packages not met in the types of the funcmap are loaded.
+func (c *reflectConverter) packageNames(infos []funcinfo.FuncInfo) (map[string]string, error) {
+	names := map[string]string{}
+	var load []string
+	for _, info := range infos {
+		if _, ok := names[info.Pkg]; ok {
+			continue
+		}
+		if pkg := c.pkgs[info.Pkg]; pkg != nil {
+			names[info.Pkg] = pkg.Name()
+			continue
+		}
+		names[info.Pkg] = ""
+		load = append(load, info.Pkg)
+	}
+	if len(load) == 0 {
+		return names, nil
+	}
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName}, load...)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("failed to load package %v: %v", pkg.PkgPath, pkg.Errors[0])
+		}
+		names[pkg.PkgPath] = pkg.Name
+	}
+	return names, nil
+}
+
+// pkgOf returns the package of an unexported field or method,
+// it is nil for exported ones.
+func (c *reflectConverter) pkgOf(pkgPath string) *types.Package {
+	if pkgPath == "" {
+		return nil
+	}
+	if pkg := c.pkgs[pkgPath]; pkg != nil {
+		return pkg
+	}
+	pkg := types.NewPackage(pkgPath, pkgPath[strings.LastIndex(pkgPath, "/")+1:])
+	c.pkgs[pkgPath] = pkg
+	return pkg
+}
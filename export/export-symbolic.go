@@ -5,34 +5,131 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/printer"
 	"go/token"
 	"go/types"
 	"io"
+	"strconv"
 	"strings"
-
-	"golang.org/x/tools/go/loader"
 )
 
 // Target defines a target package and idents to export.
+// When Idents is empty, every funcmap variable of the package is exported.
 type Target struct {
 	PkgPath string
 	Idents  []string
+	// Include lists patterns of the keys to export,
+	// every key is exported when it is empty.
+	// A pattern is a glob such as html*,
+	// or a regular expression between slashes such as /^html/.
+	Include []string
+	// Exclude lists patterns of the keys left out of the export.
+	Exclude []string
+	// Renames maps keys to the name they are exported with.
+	Renames map[string]string
+	// Prefix is added to the keys that are not renamed.
+	Prefix string
+	// Builtin tells the funcmap is called by the template package itself,
+	// its reflect.Value parameters and results are exported as interface{}.
+	Builtin bool
+}
+
+// builtinTargets are the funcmaps of the template packages,
+// the funcs of html/template come on top of those of text/template.
+var builtinTargets = map[string]Targets{
+	"@text/template": {
+		{PkgPath: "text/template", Idents: []string{"builtins"}, Builtin: true},
+	},
+	"@html/template": {
+		{PkgPath: "text/template", Idents: []string{"builtins"}, Builtin: true},
+		{PkgPath: "html/template", Idents: []string{"funcMap"}, Builtin: true},
+	},
 }
 
 // Targets is an alias of []Target
 type Targets []Target
 
-// Parse a string of package:var
+// Parse a string of package:var.
+// A package alone, or followed by :*,
+// targets every funcmap variable of the package.
+// The target can be followed by comma separated options
+// to remap its keys, such as
+// package:var,prefix=str_,rename=old=new,include=html*,exclude=/^_/.
+// @text/template and @html/template target the builtin funcs
+// of the template packages.
 func (t *Targets) Parse(s []string) error {
 	for i := 0; i < len(s); i++ {
-		parts := strings.Split(s[i], ":")
-		if len(parts) < 2 {
+		options := strings.Split(s[i], ",")
+		if strings.HasPrefix(options[0], "@") {
+			builtins, ok := builtinTargets[options[0]]
+			if !ok {
+				return fmt.Errorf("Invalid builtin target: %v", s[i])
+			}
+			for _, target := range builtins {
+				for _, option := range options[1:] {
+					if err := target.parseOption(option); err != nil {
+						return fmt.Errorf("Invalid package target: %v: %v", s[i], err)
+					}
+				}
+				*t = append(*t, target)
+			}
+			continue
+		}
+		parts := strings.Split(options[0], ":")
+		target := Target{PkgPath: parts[0]}
+		for _, ident := range parts[1:] {
+			if ident == "" {
+				return fmt.Errorf("Invalid package target: %v", s[i])
+			}
+			if ident == "*" {
+				target.Idents = nil
+				break
+			}
+			target.Idents = append(target.Idents, ident)
+		}
+		if target.PkgPath == "" {
 			return fmt.Errorf("Invalid package target: %v", s[i])
 		}
-		*t = append(*t, Target{
-			PkgPath: parts[0],
-			Idents:  parts[1:],
-		})
+		for _, option := range options[1:] {
+			if err := target.parseOption(option); err != nil {
+				return fmt.Errorf("Invalid package target: %v: %v", s[i], err)
+			}
+		}
+		*t = append(*t, target)
+	}
+	return nil
+}
+
+// parseOption parses a name=value option of a target.
+func (t *Target) parseOption(option string) error {
+	name, value, ok := strings.Cut(option, "=")
+	if !ok || value == "" {
+		return fmt.Errorf("invalid option %q", option)
+	}
+	switch name {
+	case "prefix":
+		t.Prefix = value
+	case "include", "exclude":
+		// report invalid patterns early.
+		if _, err := matchKey(value, ""); err != nil {
+			return err
+		}
+		if name == "include" {
+			t.Include = append(t.Include, value)
+		} else {
+			t.Exclude = append(t.Exclude, value)
+		}
+	case "rename":
+		old, new, ok := strings.Cut(value, "=")
+		if !ok || old == "" || new == "" {
+			return fmt.Errorf("invalid rename %q, it must be old=new", value)
+		}
+		if t.Renames == nil {
+			t.Renames = map[string]string{}
+		}
+		t.Renames[old] = new
+	default:
+		return fmt.Errorf("unknown option %q", name)
 	}
 	return nil
 }
@@ -46,92 +143,103 @@ func (t *Targets) GetPackagePaths() []string {
 	return ret
 }
 
-func astNodeToString(n ast.Node) string {
+// astNodeToString prints an ast node as go source.
+func astNodeToString(n ast.Node) (string, error) {
 	var b bytes.Buffer
-	err := format.Node(&b, token.NewFileSet(), n)
+	if err := format.Node(&b, token.NewFileSet(), n); err != nil {
+		return "", fmt.Errorf(
+			"astNodeToString: Failed to convert ast node to string: %v\n%#v",
+			err, n)
+	}
+	return b.String(), nil
+}
+
+// exprString prints an expression of an error message,
+// it is described by its type when it does not print.
+func exprString(n ast.Node) string {
+	s, err := astNodeToString(n)
 	if err != nil {
-		err := fmt.Errorf(
-			"astNodeToString: Failed to convert ast node to string\n%v\n%#v",
-			n, n)
-		panic(err)
+		return fmt.Sprintf("%T", n)
 	}
-	return b.String()
+	return s
 }
 
 // Symbolic a symbolic map of given target package and ther idents.
-func Symbolic(targetPackagePaths Targets, outvarname string, prog *loader.Program, destFile *ast.File) (*ast.GenDecl, []string, error) {
+func Symbolic(targetPackagePaths Targets, outvarname string, prog *Program, destFile *ast.File) (*ast.GenDecl, []string, error) {
+	entries, _, err := collectEntries(prog, targetPackagePaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &typeRenderer{file: destFile}
+	mapStrIntDecl, _, err := symbolicDecl(prog, entries, outvarname, r)
+	return mapStrIntDecl, r.imported, err
+}
 
-	var err error
-	var imported []string
-
-	// Add a varDecl, var xx = map[string]interface{}{}
-	mapStrIntDecl, elts := newMapStringInterfaceDelc(outvarname)
-
-	for _, targetPackagePath := range targetPackagePaths {
-
-		ourpkg := prog.Package(targetPackagePath.PkgPath)
-
-		for _, searchIdent := range targetPackagePath.Idents {
-			found := false
-			for id := range findMapStringInterface(ourpkg.Pkg, ourpkg.Defs) {
-				if id.Name == searchIdent {
-					if valueSpec, ok := id.Obj.Decl.(*ast.ValueSpec); ok {
-						found = true
-						if len(valueSpec.Values) > 0 {
-							keyValues := valueSpec.Values[0].(*ast.CompositeLit).Elts
-							for i := range keyValues {
-								key := keyValues[i].(*ast.KeyValueExpr).Key.(*ast.BasicLit)
-
-								// Create a key on the map, "x":func(){}
-								kv, fn := newKeyValueStringFuncLit(key.Value)
-								// Add the kvalue on the map
-								injectKvIntoMapStringInterface(kv, elts)
-
-								identLike := keyValues[i].(*ast.KeyValueExpr).Value
-								signature := ourpkg.Types[identLike].Type.(*types.Signature)
-
-								var err2 error
-								// Define func parameters func(p string...) {}
-								in := signature.Params()
-								// printTuple(in)
-								fn.Type.Params, err2 = newFuncParams(in, signature.Variadic())
-								if err2 != nil {
-									return nil, nil, err2
-								}
-
-								// Define func returns func(...) string... {}
-								out := signature.Results()
-								// printTuple(out)
-								fn.Type.Results, err2 = newFuncResults(out)
-								if err2 != nil {
-									return nil, nil, err2
-								}
-
-								// Define func body func(...) ... { return ""...}
-								fn.Body, err2 = newFuncBodyZeroValue(out)
-								if err2 != nil {
-									return nil, nil, err2
-								}
-
-								// extracts imports from the func
-								imported = append(imported, extractImports(in)...)
-								imported = append(imported, extractImports(out)...)
-							}
-						}
-					}
-				}
-			}
-			if found == false {
-				return nil, nil, fmt.Errorf(
-					"variable %v not found in %v",
-					searchIdent,
-					targetPackagePath.PkgPath,
-				)
+// symbolicDecl declares the symbolic map of the entries,
+// it returns the entries that were rendered,
+// entries might be skipped according to the unexported policy of the renderer.
+// Each key is given a comment about the provenance of its function.
+func symbolicDecl(prog *Program, entries []funcEntry, outvarname string, r *typeRenderer) (*ast.GenDecl, []funcEntry, error) {
+
+	var rendered funcEntries
+	funcs := map[string]*ast.FuncLit{}
+
+	// write the declaration as source, var xx = map[string]interface{}{...},
+	// so that the comments are positioned when it is parsed.
+	var b strings.Builder
+	b.WriteString("package y\n\nvar " + outvarname + " = map[string]interface{}{\n")
+
+	for _, entry := range entries {
+
+		signature, err := entry.Signature()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Create a func literal of the signature, func(...)...{}
+		fn, err := r.newFuncLit(signature)
+		if err == errSkip {
+			r.warnings = append(r.warnings, fmt.Sprintf(
+				"skipped key %q of %v:%v, its signature uses an unexported type",
+				entry.Key, entry.TargetPkg, entry.TargetVar,
+			))
+			continue
+		} else if err != nil {
+			return nil, nil, &UnsupportedTypeError{
+				PkgPath: entry.TargetPkg,
+				Var:     entry.TargetVar,
+				Key:     entry.Key,
+				Pos:     entry.Position(),
+				Err:     err,
 			}
 		}
+
+		// a key set twice keeps the position of its first value.
+		rendered.set(entry)
+		funcs[entry.Key] = fn
+	}
+
+	loadFuncPackages(prog, rendered)
+	for _, entry := range rendered {
+		for _, line := range provenance(prog, entry) {
+			b.WriteString(strings.TrimRight("\t// "+line, " ") + "\n")
+		}
+		// Create a key on the map, "x":func(){}
+		fn, err := astNodeToString(funcs[entry.Key])
+		if err != nil {
+			return nil, nil, err
+		}
+		b.WriteString("\t" + strconv.Quote(entry.Key) + ": " + fn + ",\n")
+	}
+	b.WriteString("}\n")
+
+	f, err := stringToAst(b.String())
+	if err != nil {
+		return nil, nil, err
 	}
+	r.file.Comments = append(r.file.Comments, f.Comments...)
 
-	return mapStrIntDecl, imported, err
+	return f.Decls[0].(*ast.GenDecl), rendered, nil
 }
 
 // GetVarDecl returns the ast node of the variable declaration.
@@ -169,10 +277,43 @@ func MustGetImportDecl(p *ast.File) *ast.GenDecl {
 	return i
 }
 
-//PrintAstFile prints an ast to given writer.
+// generatedFset holds the positions of the generated declarations,
+// they position the comments of the generated files.
+var generatedFset = token.NewFileSet()
+
+// PrintAstFile prints an ast to given writer.
 func PrintAstFile(w io.Writer, node interface{}) error {
-	fset := token.NewFileSet()
-	return format.Node(w, fset, node)
+	file, ok := node.(*ast.File)
+	if !ok || len(file.Comments) == 0 {
+		return format.Node(w, generatedFset, node)
+	}
+
+	// the declarations of a generated file are parsed from different sources,
+	// their positions can not be compared,
+	// print them one by one along with their comments.
+	var b bytes.Buffer
+	b.WriteString("package " + file.Name.Name + "\n")
+	for _, decl := range file.Decls {
+		var comments []*ast.CommentGroup
+		for _, c := range file.Comments {
+			if decl.Pos().IsValid() && c.Pos() >= decl.Pos() && c.End() <= decl.End() {
+				comments = append(comments, c)
+			}
+		}
+		b.WriteString("\n")
+		err := format.Node(&b, generatedFset, &printer.CommentedNode{Node: decl, Comments: comments})
+		if err != nil {
+			return err
+		}
+		b.WriteString("\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
 }
 
 func findMapStringInterface(pkg *types.Package, defs map[*ast.Ident]types.Object) map[*ast.Ident]types.Object {
@@ -184,7 +325,7 @@ func findMapStringInterface(pkg *types.Package, defs map[*ast.Ident]types.Object
 			if inner.Parent() == pkg.Scope() { // find only package level declarations
 				if isMapStringInterface(obj.Type()) {
 					res[id] = obj
-				} else if m, ok := obj.Type().(*types.Named); ok {
+				} else if m, ok := types.Unalias(obj.Type()).(*types.Named); ok {
 					if isMapStringInterface(m.Underlying()) {
 						res[id] = obj
 					}
@@ -195,56 +336,69 @@ func findMapStringInterface(pkg *types.Package, defs map[*ast.Ident]types.Object
 	return res
 }
 
-func newMapStringInterfaceDelc(varName string) (*ast.GenDecl, *ast.CompositeLit) {
-	s := &ast.GenDecl{}
-	s.Tok = token.VAR
-
-	spec := &ast.ValueSpec{}
-	spec.Names = append(spec.Names, &ast.Ident{Name: varName})
-
-	value := &ast.CompositeLit{}
-	spec.Values = append(spec.Values, value)
+// typeRenderer renders types as ast nodes of a file,
+// the packages they refer to are imported into the file.
+type typeRenderer struct {
+	file *ast.File
+	// unexported tells how to render types unexported in their package.
+	unexported UnexportedPolicy
+	// imported lists the import paths the rendered nodes refer to.
+	imported []string
+	// warnings are the entries skipped by the unexported policy.
+	warnings []string
+}
 
-	mapType := &ast.MapType{}
-	mapType.Key = &ast.Ident{Name: "string"}
-	interfaceType := &ast.InterfaceType{Methods: &ast.FieldList{}}
-	mapType.Value = interfaceType
-	value.Type = mapType
+// newFuncLit creates a func literal of the signature,
+// its body returns zero values.
+func (r *typeRenderer) newFuncLit(signature *types.Signature) (*ast.FuncLit, error) {
+	var err error
+	fn := &ast.FuncLit{Type: &ast.FuncType{}}
 
-	value.Elts = make([]ast.Expr, 0)
+	// Define func parameters func(p string...) {}
+	in := signature.Params()
+	fn.Type.Params, err = r.newFuncParams(in, signature.Variadic())
+	if err != nil {
+		return nil, err
+	}
 
-	s.Specs = append(s.Specs, spec)
+	// Define func returns func(...) string... {}
+	out := signature.Results()
+	fn.Type.Results, err = r.newFuncResults(out)
+	if err != nil {
+		return nil, err
+	}
 
-	return s, value
+	// Define func body func(...) ... { return ""...}
+	fn.Body, err = r.newFuncBodyZeroValue(out)
+	if err != nil {
+		return nil, err
+	}
+	return fn, nil
 }
 
-func newKeyValueStringFuncLit(keyName string) (*ast.KeyValueExpr, *ast.FuncLit) {
-	s := &ast.KeyValueExpr{}
-	s.Key = &ast.BasicLit{Kind: token.STRING, Value: keyName}
-
-	f := &ast.FuncLit{}
-	f.Type = &ast.FuncType{}
-	s.Value = f
-
-	return s, f
+// importName imports a package into the file,
+// it returns the name to use in selectors.
+func (r *typeRenderer) importName(importPath, pkgName string) string {
+	r.imported = append(r.imported, importPath)
+	return AddImport(r.file, importPath, pkgName)
 }
 
-func newFuncParams(tuple *types.Tuple, isVariadic bool) (*ast.FieldList, error) {
-	return typesTupleToAstFieldList(tuple, isVariadic, true)
+func (r *typeRenderer) newFuncParams(tuple *types.Tuple, isVariadic bool) (*ast.FieldList, error) {
+	return r.typesTupleToAstFieldList(tuple, isVariadic, true)
 }
 
-func newFuncResults(tuple *types.Tuple) (*ast.FieldList, error) {
-	return typesTupleToAstFieldList(tuple, false, false)
+func (r *typeRenderer) newFuncResults(tuple *types.Tuple) (*ast.FieldList, error) {
+	return r.typesTupleToAstFieldList(tuple, false, false)
 }
 
-func newFuncBodyZeroValue(tuple *types.Tuple) (*ast.BlockStmt, error) {
+func (r *typeRenderer) newFuncBodyZeroValue(tuple *types.Tuple) (*ast.BlockStmt, error) {
 	s := &ast.BlockStmt{}
 	if tuple.Len() > 0 {
 		ret := &ast.ReturnStmt{}
 		s.List = append(s.List, ret)
 
 		for i := 0; i < tuple.Len(); i++ {
-			t, err := typesTypeToAstZeroValue(tuple.At(i).Type(), false)
+			t, err := r.typesTypeToAstZeroValue(tuple.At(i).Type())
 			if err != nil {
 				return nil, err
 			}
@@ -256,142 +410,84 @@ func newFuncBodyZeroValue(tuple *types.Tuple) (*ast.BlockStmt, error) {
 
 // typesTypeToAstZeroValue transforms a types.Type
 // into an ast expression of its zero value
-func typesTypeToAstZeroValue(t types.Type, asIdent bool) (ast.Expr, error) {
+func (r *typeRenderer) typesTypeToAstZeroValue(t types.Type) (ast.Expr, error) {
 	var ret ast.Expr
 	switch m := t.(type) {
-	case *types.Basic:
+	case *types.Alias:
+		return r.typesTypeToAstZeroValue(types.Unalias(m))
 
-		if asIdent == false {
-			switch m.Kind() {
-			case types.String:
-				ret = &ast.BasicLit{Kind: token.STRING, Value: "\"\""}
-			case types.Bool:
-				ret = &ast.BasicLit{Kind: token.STRING, Value: "false"}
-			case types.Int, types.Int8, types.Int16, types.Int32, types.Int64:
-				ret = &ast.BasicLit{Kind: token.STRING, Value: "0"}
-			case types.Uint, types.Byte /*==Uint8*/, types.Uint16, types.Uint32, types.Uint64:
-				ret = &ast.BasicLit{Kind: token.STRING, Value: "0"}
-			case types.Float32, types.Float64:
-				ret = &ast.BasicLit{Kind: token.STRING, Value: "0"}
-			default:
-				return nil, fmt.Errorf("Unhandled basic zero value %v", m)
-			}
-		} else {
-			ret = &ast.Ident{Name: m.Name()}
+	case *types.Basic:
+		info := m.Info()
+		switch {
+		case info&types.IsString != 0:
+			ret = &ast.BasicLit{Kind: token.STRING, Value: "\"\""}
+		case info&types.IsBoolean != 0:
+			ret = &ast.Ident{Name: "false"}
+		case info&types.IsNumeric != 0:
+			ret = &ast.BasicLit{Kind: token.INT, Value: "0"}
+		case m.Kind() == types.UnsafePointer:
+			ret = &ast.Ident{Name: "nil"}
+		default:
+			return nil, fmt.Errorf("Unhandled basic zero value %v", m)
 		}
 
 	case *types.Named:
-		switch u := t.Underlying().(type) {
+		if m.Obj().Pkg() == nil { // error, comparable
+			return &ast.Ident{Name: "nil"}, nil
+		}
+		if m.Obj().Exported() == false {
+			t, err := r.unexportedType(m)
+			if err != nil {
+				return nil, err
+			}
+			return r.typesTypeToAstZeroValue(t)
+		}
+		switch u := m.Underlying().(type) {
 		case *types.Basic:
-			call := &ast.CallExpr{}
-			fun := &ast.SelectorExpr{}
-			if m.Obj().Exported() == false {
-				return nil, fmt.Errorf("Cannot use unexported type to create a zero value %v", m)
+			if u.Kind() == types.UnsafePointer {
+				return &ast.Ident{Name: "nil"}, nil
 			}
-			fun.X = &ast.Ident{Name: m.Obj().Pkg().Name()}
-			fun.Sel = &ast.Ident{Name: m.Obj().Name()}
-			call.Fun = fun
-			t, err := typesTypeToAstZeroValue(u, false)
+			fun, err := r.typesTypeToAstExpr(m, false)
 			if err != nil {
 				return nil, err
 			}
-			call.Args = append(call.Args, t)
-			ret = call
-
-		case *types.Struct:
-			sel := &ast.SelectorExpr{}
-			if m.Obj().Exported() == false {
-				return nil, fmt.Errorf("Cannot use unexported type to create a zero value %v", m)
-			}
-			sel.X = &ast.Ident{Name: m.Obj().Pkg().Name()}
-			sel.Sel = &ast.Ident{Name: m.Obj().Name()}
-			if asIdent == false {
-				ret = &ast.CompositeLit{Type: sel}
-			} else {
-				ret = sel
+			x, err := r.typesTypeToAstZeroValue(u)
+			if err != nil {
+				return nil, err
 			}
-		case *types.Interface:
-			ret = &ast.Ident{Name: "nil"}
-
-		default:
-			fmt.Printf("%#v\n", m)
-			return nil, fmt.Errorf("Unhandled named arg zero value %v", m)
-		}
+			ret = &ast.CallExpr{Fun: fun, Args: []ast.Expr{x}}
 
-	case *types.Pointer:
-		if asIdent == false {
-			ret = &ast.Ident{Name: "nil"}
-		} else {
-			x, err := typesTypeToAstZeroValue(m.Elem(), true)
+		case *types.Struct, *types.Array:
+			x, err := r.typesTypeToAstExpr(m, false)
 			if err != nil {
 				return nil, err
 			}
-			ret = &ast.StarExpr{X: x}
-		}
+			ret = &ast.CompositeLit{Type: x}
 
-	case *types.Interface:
-		if asIdent == false {
+		case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
 			ret = &ast.Ident{Name: "nil"}
-		} else {
-			ret = &ast.InterfaceType{Methods: &ast.FieldList{}}
-		}
 
-	case *types.Slice:
-		x, err := typesTypeToAstZeroValue(m.Elem(), true)
-		if err != nil {
-			return nil, err
-		}
-		ret = &ast.ArrayType{Elt: x}
-		if asIdent == false {
-			ret = &ast.CompositeLit{Type: ret}
+		default:
+			return nil, fmt.Errorf("Unhandled named arg zero value %v", m)
 		}
 
-	case *types.Map:
-		x, err := typesTypeToAstZeroValue(m.Key(), true)
+	case *types.Pointer, *types.Chan, *types.Signature, *types.Interface:
+		ret = &ast.Ident{Name: "nil"}
+
+	case *types.Slice, *types.Map, *types.Array, *types.Struct:
+		x, err := r.typesTypeToAstExpr(m, false)
 		if err != nil {
 			return nil, err
 		}
-		x2, err2 := typesTypeToAstZeroValue(m.Elem(), true)
-		if err2 != nil {
-			return nil, err2
-		}
-		ret = &ast.MapType{Key: x, Value: x2}
-		if asIdent == false {
-			ret = &ast.CompositeLit{Type: ret}
-		}
+		ret = &ast.CompositeLit{Type: x}
 
 	default:
-		fmt.Printf("%#v\n", m)
 		return nil, fmt.Errorf("Unhandled named arg zero value %v", m)
 	}
 	return ret, nil
 }
 
-func extractImports(tuple *types.Tuple) []string {
-	ret := make([]string, 0)
-	for i := 0; i < tuple.Len(); i++ {
-		importPath := typesTupleToImportPath(tuple.At(i).Type())
-		if importPath != "" {
-			ret = append(ret, importPath)
-		}
-	}
-	return ret
-}
-
-func typesTupleToImportPath(t types.Type) string {
-	ret := ""
-	switch m := t.(type) {
-	case *types.Named:
-		if m.Obj().Pkg() != nil {
-			ret = m.Obj().Pkg().Path()
-		}
-	case *types.Pointer:
-		ret = typesTupleToImportPath(m.Elem())
-	}
-	return ret
-}
-
-func typesTupleToAstFieldList(tuple *types.Tuple, isVariadic, withNames bool) (*ast.FieldList, error) {
+func (r *typeRenderer) typesTupleToAstFieldList(tuple *types.Tuple, isVariadic, withNames bool) (*ast.FieldList, error) {
 	if tuple.Len() == 0 {
 		return nil, nil
 	}
@@ -403,9 +499,13 @@ func typesTupleToAstFieldList(tuple *types.Tuple, isVariadic, withNames bool) (*
 		field := &ast.Field{}
 		if withNames {
 			name := &ast.Ident{Name: tuple.At(i).Name()}
+			if name.Name == "" {
+				// params of a func type might be unnamed.
+				name.Name = fmt.Sprintf("arg%v", i)
+			}
 			field.Names = append(field.Names, name)
 		}
-		field.Type, err = typesTypeToAstExpr(tuple.At(i).Type(), isVariadic && i == tuple.Len()-1)
+		field.Type, err = r.typesTypeToAstExpr(tuple.At(i).Type(), isVariadic && i == tuple.Len()-1)
 		if err != nil {
 			return nil, err
 		}
@@ -417,55 +517,166 @@ func typesTupleToAstFieldList(tuple *types.Tuple, isVariadic, withNames bool) (*
 
 // typesTypeToAstExpr transform a types.Type
 // into an ast.Expr suitable for func params/results
-func typesTypeToAstExpr(t types.Type, ellisped bool) (ast.Expr, error) {
+func (r *typeRenderer) typesTypeToAstExpr(t types.Type, ellisped bool) (ast.Expr, error) {
 	switch m := t.(type) {
+	case *types.Alias:
+		return r.typesTypeToAstExpr(types.Unalias(m), ellisped)
+
 	case *types.Basic:
+		if m.Kind() == types.UnsafePointer {
+			x := &ast.Ident{Name: r.importName("unsafe", "unsafe")}
+			return &ast.SelectorExpr{X: x, Sel: &ast.Ident{Name: "Pointer"}}, nil
+		}
 		return &ast.Ident{Name: m.Name()}, nil
 
 	case *types.Named:
-		isUniverse := m.Obj().Parent().Parent() == nil
-		isError := m.Obj().Name() == "error"
-		if isUniverse && isError {
-			return &ast.Ident{Name: "error"}, nil
+		if m.Obj().Pkg() == nil { // error, comparable
+			return &ast.Ident{Name: m.Obj().Name()}, nil
 		}
 		if m.Obj().Exported() == false {
-			return nil, fmt.Errorf("Cannot use unexported type %v", m)
+			t, err := r.unexportedType(m)
+			if err != nil {
+				return nil, err
+			}
+			return r.typesTypeToAstExpr(t, ellisped)
 		}
 		sel := &ast.SelectorExpr{}
-		sel.X = &ast.Ident{Name: m.Obj().Pkg().Name()}
+		sel.X = &ast.Ident{Name: r.importName(m.Obj().Pkg().Path(), m.Obj().Pkg().Name())}
 		sel.Sel = &ast.Ident{Name: m.Obj().Name()}
-		return sel, nil
+		if m.TypeArgs().Len() == 0 {
+			return sel, nil
+		}
+		// an instantiated generic type, such as iter.Seq[string]
+		var indices []ast.Expr
+		for i := 0; i < m.TypeArgs().Len(); i++ {
+			x, err := r.typesTypeToAstExpr(m.TypeArgs().At(i), false)
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, x)
+		}
+		if len(indices) == 1 {
+			return &ast.IndexExpr{X: sel, Index: indices[0]}, nil
+		}
+		return &ast.IndexListExpr{X: sel, Indices: indices}, nil
+
+	case *types.TypeParam:
+		return nil, fmt.Errorf("Cannot use type parameter %v, the function must be instantiated", m)
 
 	case *types.Pointer:
 		var err error
 		ret := &ast.StarExpr{}
-		ret.X, err = typesTypeToAstExpr(m.Elem(), false)
+		ret.X, err = r.typesTypeToAstExpr(m.Elem(), false)
 		return ret, err
 
 	case *types.Interface:
-		return &ast.InterfaceType{Methods: &ast.FieldList{}}, nil
+		ret := &ast.InterfaceType{Methods: &ast.FieldList{}}
+		for i := 0; i < m.NumEmbeddeds(); i++ {
+			x, err := r.typesTypeToAstExpr(m.EmbeddedType(i), false)
+			if err != nil {
+				return nil, err
+			}
+			ret.Methods.List = append(ret.Methods.List, &ast.Field{Type: x})
+		}
+		for i := 0; i < m.NumExplicitMethods(); i++ {
+			method := m.ExplicitMethod(i)
+			if method.Exported() == false {
+				return nil, fmt.Errorf("Cannot use interface with unexported method %v", m)
+			}
+			x, err := r.typesTypeToAstExpr(method.Type(), false)
+			if err != nil {
+				return nil, err
+			}
+			ret.Methods.List = append(ret.Methods.List, &ast.Field{
+				Names: []*ast.Ident{{Name: method.Name()}},
+				Type:  x,
+			})
+		}
+		return ret, nil
 
 	case *types.Slice:
 		if ellisped {
-			t, err := typesTypeToAstExpr(m.Elem(), false)
+			t, err := r.typesTypeToAstExpr(m.Elem(), false)
 			return &ast.Ellipsis{Elt: t}, err
 		}
-		t, err := typesTypeToAstExpr(m.Elem(), false)
+		t, err := r.typesTypeToAstExpr(m.Elem(), false)
 		return &ast.ArrayType{Elt: t}, err
 
+	case *types.Array:
+		t, err := r.typesTypeToAstExpr(m.Elem(), false)
+		length := &ast.BasicLit{Kind: token.INT, Value: fmt.Sprint(m.Len())}
+		return &ast.ArrayType{Len: length, Elt: t}, err
+
 	case *types.Map:
 		ret := &ast.MapType{}
-		t, err := typesTypeToAstExpr(m.Key(), false)
+		t, err := r.typesTypeToAstExpr(m.Key(), false)
 		if err != nil {
 			return nil, err
 		}
 		ret.Key = t
-		t2, err2 := typesTypeToAstExpr(m.Elem(), false)
+		t2, err2 := r.typesTypeToAstExpr(m.Elem(), false)
 		if err2 != nil {
 			return nil, err2
 		}
 		ret.Value = t2
 		return ret, nil
+
+	case *types.Chan:
+		ret := &ast.ChanType{}
+		switch m.Dir() {
+		case types.SendRecv:
+			ret.Dir = ast.SEND | ast.RECV
+		case types.SendOnly:
+			ret.Dir = ast.SEND
+		case types.RecvOnly:
+			ret.Dir = ast.RECV
+		}
+		t, err := r.typesTypeToAstExpr(m.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		// chan (<-chan int) needs parenthesis.
+		if c, ok := m.Elem().(*types.Chan); ok && m.Dir() == types.SendRecv && c.Dir() == types.RecvOnly {
+			t = &ast.ParenExpr{X: t}
+		}
+		ret.Value = t
+		return ret, nil
+
+	case *types.Signature:
+		ret := &ast.FuncType{}
+		var err error
+		ret.Params, err = r.typesTupleToAstFieldList(m.Params(), m.Variadic(), false)
+		if err != nil {
+			return nil, err
+		}
+		if ret.Params == nil {
+			ret.Params = &ast.FieldList{}
+		}
+		ret.Results, err = r.typesTupleToAstFieldList(m.Results(), false, false)
+		return ret, err
+
+	case *types.Struct:
+		ret := &ast.StructType{Fields: &ast.FieldList{}}
+		for i := 0; i < m.NumFields(); i++ {
+			f := m.Field(i)
+			x, err := r.typesTypeToAstExpr(f.Type(), false)
+			if err != nil {
+				return nil, err
+			}
+			field := &ast.Field{Type: x}
+			if f.Embedded() == false {
+				field.Names = []*ast.Ident{{Name: f.Name()}}
+			}
+			if tag := m.Tag(i); tag != "" {
+				value := strconv.Quote(tag)
+				if strconv.CanBackquote(tag) {
+					value = "`" + tag + "`"
+				}
+				field.Tag = &ast.BasicLit{Kind: token.STRING, Value: value}
+			}
+			ret.Fields.List = append(ret.Fields.List, field)
+		}
+		return ret, nil
 	}
 	return nil, fmt.Errorf("Unhandled param type %v", t)
 }
@@ -524,10 +735,10 @@ func isMapStringInterface(t types.Type) bool {
 	if t == nil {
 		return false
 	}
-	if m, ok := t.(*types.Map); ok { // find only map declaration
-		// look for map[string]interface{}
-		if b, okk := m.Key().(*types.Basic); okk && b.Kind() == types.String {
-			if _, okkk := m.Elem().(*types.Interface); okkk {
+	if m, ok := types.Unalias(t).(*types.Map); ok { // find only map declaration
+		// look for map[string]interface{}, or map[string]any
+		if b, okk := types.Unalias(m.Key()).(*types.Basic); okk && b.Kind() == types.String {
+			if _, okkk := types.Unalias(m.Elem()).(*types.Interface); okkk {
 				return true
 			}
 		}
@@ -535,35 +746,6 @@ func isMapStringInterface(t types.Type) bool {
 	return false
 }
 
-func injectKvIntoMapStringInterface(kv *ast.KeyValueExpr, elts *ast.CompositeLit) {
-	newkeyName := kv.Key.(*ast.BasicLit).Value
-	for i, e := range elts.Elts {
-		x := e.(*ast.KeyValueExpr).Key.(*ast.BasicLit).Value
-		if x == newkeyName {
-			elts.Elts[i] = kv
-			return
-		}
-	}
-	elts.Elts = append(elts.Elts, kv)
-}
-
-// GetProgram creates a new Program of a list of packages.
-func GetProgram(pkgs []string) (*loader.Program, error) {
-
-	var conf loader.Config
-	_, err := conf.FromArgs(pkgs, false)
-	if err != nil {
-		return nil, err
-	}
-
-	prog, err2 := conf.Load()
-	if err2 != nil {
-		return nil, err2
-	}
-
-	return prog, err
-}
-
 // NewPkg creates a new go package.
 func NewPkg(fileName string, pkgName string) (*ast.Package, *ast.File) {
 
@@ -579,6 +761,7 @@ func NewPkg(fileName string, pkgName string) (*ast.Package, *ast.File) {
 }
 
 // AddImportDecl creates and add an import statement to the file.
+// Imports registered into the file with AddImport keep their alias.
 func AddImportDecl(file *ast.File, imports []string) {
 	if len(imports) > 0 {
 		// Add a GenDecl import statement node to the file tree.
@@ -588,7 +771,20 @@ func AddImportDecl(file *ast.File, imports []string) {
 		file.Decls = append(file.Decls, importGenDecl)
 
 		// inject package path consumed by the new map variable into the file.
-		InjectImportPaths(imports, importGenDecl)
+		for _, importPath := range imports {
+			spec := getImportSpec(file, importPath)
+			if spec == nil {
+				spec = NewImportSpec(importPath, "")
+				file.Imports = append(file.Imports, spec)
+			}
+			duplicate := false
+			for _, s := range importGenDecl.Specs {
+				duplicate = duplicate || s == spec
+			}
+			if duplicate == false {
+				importGenDecl.Specs = append(importGenDecl.Specs, spec)
+			}
+		}
 
 		// Make a mutiline import declaration.
 		importGenDecl.Lparen = token.Pos(1)
@@ -2,13 +2,18 @@ package export_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"go/format"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
-
-	"golang.org/x/tools/go/loader"
+	"text/template"
 
 	"github.com/mh-cbon/export-funcmap/export"
+	"gopkg.in/yaml.v3"
 )
 
 type testData struct {
@@ -17,6 +22,9 @@ type testData struct {
 	expectErr      bool
 	expectKeyCount int
 	expectContents string
+	// skipComments ignores the comments of the result,
+	// the positions of the std packages vary with the go version.
+	skipComments bool
 	// expectContents []*regexp.Regexp
 }
 
@@ -35,10 +43,13 @@ func TestBool(t *testing.T) {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g bool) bool {
-return false
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:18.
+	"fn": func(g bool) bool {
+		return false
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -46,10 +57,13 @@ return false
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g byte) byte {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:21.
+	"fn": func(g byte) byte {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -57,10 +71,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g int) int {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:24.
+	"fn": func(g int) int {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -68,10 +85,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g int8) int8 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:27.
+	"fn": func(g int8) int8 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -79,10 +99,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g int16) int16 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:30.
+	"fn": func(g int16) int16 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -90,10 +113,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g int32) int32 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:33.
+	"fn": func(g int32) int32 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -101,10 +127,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g int64) int64 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:36.
+	"fn": func(g int64) int64 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -112,10 +141,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g uint) uint {
-return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:39.
+	"fn": func(g uint) uint {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -123,10 +155,13 @@ return 0
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g uint8) uint8 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:42.
+	"fn": func(g uint8) uint8 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -134,10 +169,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g uint16) uint16 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:45.
+	"fn": func(g uint16) uint16 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -145,10 +183,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g uint32) uint32 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:48.
+	"fn": func(g uint32) uint32 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -156,10 +197,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g uint64) uint64 {
-  return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:51.
+	"fn": func(g uint64) uint64 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -167,10 +211,13 @@ var tomate = map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g float32) float32 {
-return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:54.
+	"fn": func(g float32) float32 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -178,10 +225,13 @@ return 0
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g float64) float64 {
-return 0
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:57.
+	"fn": func(g float64) float64 {
+		return 0
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -189,10 +239,13 @@ return 0
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -200,12 +253,15 @@ return ""
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g interface {
-}) interface {
-} {
-return nil
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:60.
+	"fn": func(g interface {
+	}) interface {
+	} {
+		return nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -213,10 +269,13 @@ return nil
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g ...string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:63.
+	"fn": func(g ...string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -224,10 +283,13 @@ return ""
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(k int, g ...string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:66.
+	"fn": func(k int, g ...string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -235,10 +297,13 @@ return ""
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string) error {
-return nil
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:69.
+	"fn": func(g string) error {
+		return nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -246,10 +311,13 @@ return nil
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string, v string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:72.
+	"fn": func(g string, v string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -257,10 +325,13 @@ return ""
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string) (string, error) {
-return "", nil
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:75.
+	"fn": func(g string) (string, error) {
+		return "", nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -268,10 +339,13 @@ return "", nil
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string, v string) (string, error) {
-return "", nil
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:78.
+	"fn": func(g string, v string) (string, error) {
+		return "", nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -280,13 +354,16 @@ return "", nil
 			expectContents: `package gen
 
 import (
-"html/template"
+	"html/template"
 )
 
-var tomate = map[string]interface {
-}{"fn": func(g template.HTML) template.HTML {
-return template.HTML("")
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:81.
+	"fn": func(g template.HTML) template.HTML {
+		return template.HTML("")
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -295,13 +372,16 @@ return template.HTML("")
 			expectContents: `package gen
 
 import (
-"github.com/mh-cbon/export-funcmap/export/test"
+	a "github.com/mh-cbon/export-funcmap/export/test"
 )
 
-var tomate = map[string]interface {
-}{"fn": func(g a.SomeStruct) a.SomeStruct {
-return a.SomeStruct{}
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:84.
+	"fn": func(g a.SomeStruct) a.SomeStruct {
+		return a.SomeStruct{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -310,13 +390,16 @@ return a.SomeStruct{}
 			expectContents: `package gen
 
 import (
-"github.com/mh-cbon/export-funcmap/export/test"
+	a "github.com/mh-cbon/export-funcmap/export/test"
 )
 
-var tomate = map[string]interface {
-}{"fn": func(g a.SomeInterface) a.SomeInterface {
-return nil
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:87.
+	"fn": func(g a.SomeInterface) a.SomeInterface {
+		return nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -324,10 +407,13 @@ return nil
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g []string) []string {
-return []string{}
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:93.
+	"fn": func(g []string) []string {
+		return []string{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -335,10 +421,13 @@ return []string{}
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g []*string) []*string {
-return []*string{}
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:99.
+	"fn": func(g []*string) []*string {
+		return []*string{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -346,10 +435,17 @@ return []*string{}
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g []*a.SomeStruct) []*a.SomeStruct {
-return []*a.SomeStruct{}
-}}`,
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:102.
+	"fn": func(g []*a.SomeStruct) []*a.SomeStruct {
+		return []*a.SomeStruct{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -357,10 +453,13 @@ return []*a.SomeStruct{}
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g [][]string) [][]string {
-return [][]string{}
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:96.
+	"fn": func(g [][]string) [][]string {
+		return [][]string{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -368,10 +467,17 @@ return [][]string{}
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g [][]a.SomeStruct) [][]a.SomeStruct {
-return [][]a.SomeStruct{}
-}}`,
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:105.
+	"fn": func(g [][]a.SomeStruct) [][]a.SomeStruct {
+		return [][]a.SomeStruct{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -379,13 +485,16 @@ return [][]a.SomeStruct{}
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g map[string]interface {
-}) map[string]interface {
-} {
-return map[string]interface {
-}{}
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:108.
+	"fn": func(g map[string]interface {
+	}) map[string]interface {
+	} {
+		return map[string]interface {
+		}{}
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -393,10 +502,13 @@ return map[string]interface {
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"fn": func(g string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -404,12 +516,17 @@ return ""
 			expectKeyCount: 2,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"otherfn": func(o string) string {
-return ""
-}, "fn": func(g string) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "otherfn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:112.
+	"otherfn": func(o string) string {
+		return ""
+	},
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -418,13 +535,16 @@ return ""
 			expectContents: `package gen
 
 import (
-"bytes"
+	"bytes"
 )
 
-var tomate = map[string]interface {
-}{"fn": func(o bytes.Buffer) string {
-return ""
-}}`,
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:115.
+	"fn": func(o bytes.Buffer) string {
+		return ""
+	},
+}
+`,
 		},
 		testData{
 			pkg:            tpkg,
@@ -432,9 +552,365 @@ return ""
 			expectKeyCount: 1,
 			expectContents: `package gen
 
-var tomate = map[string]interface {
-}{"_html_template_attrescaper": func() {
-}}`,
+var tomate = map[string]interface{}{
+	// "_html_template_attrescaper" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:119.
+	"_html_template_attrescaper": func() {
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"funcMapFn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:124.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"callfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:124.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"initfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:133.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"mergedfn"},
+			expectKeyCount: 2,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "otherfn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:112.
+	"otherfn": func(o string) string {
+		return ""
+	},
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"copiedfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:15.
+	"fn": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"constkeyfn"},
+			expectKeyCount: 4,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "upper" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:230.
+	"upper": func(g string) string {
+		return ""
+	},
+	// "str_upper" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:231.
+	"str_upper": func(g string) string {
+		return ""
+	},
+	// "somekey" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:232.
+	"somekey": func(g string) string {
+		return ""
+	},
+	// "str_lower" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:236.
+	"str_lower": func(g string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"runefn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:158.
+	"fn": func(g rune) rune {
+		return 0
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"uintptrfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:161.
+	"fn": func(g uintptr) uintptr {
+		return 0
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"complex64fn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:164.
+	"fn": func(g complex64) complex64 {
+		return 0
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"complex128fn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:167.
+	"fn": func(g complex128) complex128 {
+		return 0
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"arrayfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:170.
+	"fn": func(g [2]string) [2]string {
+		return [2]string{}
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"chanfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:173.
+	"fn": func(g chan string, r <-chan int) chan<- bool {
+		return nil
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"funcTypefn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:176.
+	"fn": func(g func(string, ...int) error) func() (string, error) {
+		return nil
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"structLitfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:179.
+	"fn": func(g struct {
+		A string ` + "`" + `json:"a"` + "`" + `
+	}) struct {
+		B int
+	} {
+		return struct {
+			B int
+		}{}
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"interfaceMethodsfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+import (
+	"fmt"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:186.
+	"fn": func(g interface {
+		String() string
+	}) interface {
+		fmt.Stringer
+		Name() string
+	} {
+		return nil
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"namedSlicefn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:194.
+	"fn": func(g a.SomeSlice) a.SomeMap {
+		return nil
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"namedFuncfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:197.
+	"fn": func(g a.SomeFunc) a.SomePointer {
+		return nil
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"namedArrayfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:200.
+	"fn": func(g a.SomeArray) a.SomeArray {
+		return a.SomeArray{}
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"funcValuefn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+var tomate = map[string]interface{}{
+	// "fn" is someFuncValue of github.com/mh-cbon/export-funcmap/export/test, at github.com/mh-cbon/export-funcmap/export/test/test.go:203.
+	"fn": func(arg0 string) string {
+		return ""
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"genericfn"},
+			expectKeyCount: 3,
+			skipComments:   true,
+			expectContents: `package gen
+
+import (
+	a "github.com/mh-cbon/export-funcmap/export/test"
+	"iter"
+)
+
+var tomate = map[string]interface{}{
+	"keys": func(m map[string]int) iter.Seq[string] {
+		return nil
+	},
+	"contains": func(s []string, v string) bool {
+		return false
+	},
+	"pair": func(k string, v a.SomeStruct) a.Pair[string, a.SomeStruct] {
+		return a.Pair[string, a.SomeStruct]{}
+	},
+}
+`,
+		},
+		testData{
+			pkg:            tpkg,
+			varnames:       []string{"templatesfn"},
+			expectKeyCount: 1,
+			expectContents: `package gen
+
+import (
+	"html/template"
+	texttemplate "text/template"
+)
+
+var tomate = map[string]interface{}{
+	// "fn" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:215.
+	"fn": func(g template.HTML) *texttemplate.Template {
+		return nil
+	},
+}
+`,
 		},
 		testData{
 			pkg:       tpkg,
@@ -448,7 +924,7 @@ var tomate = map[string]interface {
 		},
 	}
 
-	progs := map[string]*loader.Program{}
+	progs := map[string]*export.Program{}
 
 	for _, data := range datas {
 		if _, ok := progs[data.pkg]; ok == false {
@@ -466,7 +942,7 @@ var tomate = map[string]interface {
 	}
 }
 
-func execTest(data testData, t *testing.T, prog *loader.Program) bool {
+func execTest(data testData, t *testing.T, prog *export.Program) bool {
 
 	targets := []export.Target{
 		export.Target{
@@ -507,6 +983,10 @@ func execTest(data testData, t *testing.T, prog *loader.Program) bool {
 		)
 	}
 
+	if data.skipComments {
+		str = stripComments(str)
+	}
+
 	if formatGoCode(data.expectContents) != formatGoCode(str) {
 		t.Errorf(
 			"Test %v: Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v",
@@ -546,10 +1026,869 @@ func TestParse(t *testing.T) {
 	}
 }
 
-func formatGoCode(s string) string {
-	fmtExpected, err := format.Source([]byte(s))
+func TestParseOptions(t *testing.T) {
+	targets := export.Targets{}
+	err := targets.Parse([]string{"package:var,prefix=str_,rename=a=b,rename=c=d,exclude=e,exclude=f"})
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%v", targets[0])
+	expect := "{package [var] [] [e f] map[a:b c:d] str_ false}"
+	if got != expect {
+		t.Errorf("Expected target=%v, got=%v", expect, got)
+	}
+
+	for _, s := range []string{"package:var,prefix", "package:var,rename=a", "package:var,nope=a", "package:var,include=[", "package:var,exclude=/(/"} {
+		if err := (&export.Targets{}).Parse([]string{s}); err == nil {
+			t.Errorf("Expected an error for %v", s)
+		}
+	}
+}
+
+func TestRemap(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{}
+	err := targets.Parse([]string{"github.com/mh-cbon/export-funcmap/test:k2,prefix=t_,rename=a=escape,exclude=b,exclude=c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	export.PrintAstFile(&b, res.File)
+	str := b.String()
+
+	keys := keyMatch.FindAllString(str, -1)
+	got := strings.Join(keys, " ")
+	expect := `"escape": "t_yy": "t_zz": "t_ii": "t_uu": "t_g": "t_dup":`
+	if got != expect {
+		t.Errorf("Invalid keys,\nexpected=%v\ngot=%v", expect, got)
+	}
+	for _, expect := range []string{`FuncName: "escape", Sel: "template.JSEscapeString"`, `FuncName: "t_yy", Sel: "a.SomeFn"`} {
+		if !strings.Contains(str, expect) {
+			t.Errorf("Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", expect, str)
+		}
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got=%v", res.Warnings)
+	}
+
+	// a key renamed onto another key is a conflict.
+	targets = export.Targets{}
+	if err := targets.Parse([]string{"github.com/mh-cbon/export-funcmap/test:k2,rename=a=b"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	var conflict *export.KeyConflictError
+	if !errors.As(err, &conflict) || len(conflict.Conflicts) != 1 || conflict.Conflicts[0].Key != "b" {
+		t.Errorf("Expected a KeyConflictError, got=%v", err)
+	}
+
+	// a renamed key that does not exist is reported.
+	targets = export.Targets{}
+	if err := targets.Parse([]string{"github.com/mh-cbon/export-funcmap/test:k2,rename=nope=x"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `key "nope" renamed as "x" is not a key of github.com/mh-cbon/export-funcmap/test:k2`
+	if len(res.Warnings) != 1 || res.Warnings[0] != expect {
+		t.Errorf("Expected a warning %q, got=%v", expect, res.Warnings)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	export.EnableCache = false
+
+	datas := []struct {
+		target     string
+		expectKeys string
+	}{
+		{"text/template:builtins,include=html,include=/^print/", `"html": "print": "printf": "println":`},
+		{"text/template:builtins,include=*l*,exclude=/^(html|call)$/", `"slice": "len": "println": "urlquery": "le": "lt":`},
+		{"html/template:funcMap,exclude=/^_/", ``},
+		{"html/template:funcMap,include=_html_template_*,exclude=*escaper", `"_html_template_cssvaluefilter": "_html_template_htmlnamefilter": "_html_template_urlfilter": "_html_template_urlnormalizer":`},
+	}
+
+	for _, data := range datas {
+		targets := export.Targets{}
+		if err := targets.Parse([]string{data.target}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		export.PrintAstFile(&b, res.File)
+		got := strings.Join(keyMatch.FindAllString(b.String(), -1), " ")
+		if got != data.expectKeys {
+			t.Errorf("Test %v: Invalid keys,\nexpected=%v\ngot=%v", data.target, data.expectKeys, got)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	export.EnableCache = false
+
+	datas := []struct {
+		target         string
+		expectContents []string
+	}{
+		{"@text/template,include=and,include=index", []string{
+			"\"and\": func(arg0 interface {\n\t}, args ...interface {\n\t}) interface {\n\t} {\n\t\treturn nil\n\t},",
+			"\"index\": func(item interface {\n\t}, indexes ...interface {\n\t}) (interface {\n\t}, error) {",
+		}},
+		{"@html/template,prefix=h_", []string{
+			"\"h_and\": func(arg0 interface {",
+			"\"h__html_template_urlfilter\": func(args ...interface {",
+		}},
+	}
+
+	for _, data := range datas {
+		targets := export.Targets{}
+		if err := targets.Parse([]string{data.target}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		export.PrintAstFile(&b, res.File)
+		got := b.String()
+		if strings.Contains(got, "reflect") {
+			t.Errorf("Test %v: reflect.Value should not be exported,\n%v", data.target, got)
+		}
+		for _, expect := range data.expectContents {
+			if !strings.Contains(got, expect) {
+				t.Errorf("Test %v: Invalid content,\nexpected=%v\ngot=%v", data.target, expect, got)
+			}
+		}
+	}
+
+	targets := export.Targets{}
+	if err := targets.Parse([]string{"@unknown"}); err == nil {
+		t.Error("Expected an error for an unknown builtin target")
+	}
+}
+
+type unexportedResult struct{}
+
+func TestFromFuncMap(t *testing.T) {
+	funcs := map[string]interface{}{
+		"html":   template.HTMLEscaper,
+		"printf": fmt.Sprintf,
+		"lookup": func(t *template.Template, name string) (*template.Template, error) { return nil, nil },
+		"ch":     func(c <-chan map[string][]int) {},
+		"hidden": func() unexportedResult { return unexportedResult{} },
+		"yaml":   yaml.Marshal,
+	}
+
+	res, err := export.Config{Unexported: export.UnexportedSkip}.FromFuncMap(funcs, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	export.PrintAstFile(&b, res.File)
+	got := b.String()
+
+	expectContents := []string{
+		`"text/template"`,
+		`// "html" is text/template.HTMLEscaper, at text/template/funcs.go:`,
+		"\"ch\": func(arg0 <-chan map[string][]int) {\n\t},",
+		"\"lookup\": func(arg0 *template.Template, arg1 string) (*template.Template, error) {\n\t\treturn nil, nil\n\t},",
+		"\"printf\": func(arg0 string, arg1 ...interface {\n\t}) string {",
+		`{FuncName: "printf", Sel: "fmt.Sprintf", Pkg: "fmt", PkgName: "fmt", Signature: "func(string, ...interface{}) string", Pos: "fmt/print.go:`,
+		`// "yaml" is gopkg.in/yaml.v3.Marshal, at gopkg.in/yaml.v3/yaml.go:`,
+		`{FuncName: "yaml", Sel: "yaml.Marshal", Pkg: "gopkg.in/yaml.v3", PkgName: "yaml", Signature: "func(interface{}) ([]uint8, error)", Pos: "gopkg.in/yaml.v3/yaml.go:`,
+	}
+	for _, expect := range expectContents {
+		if !strings.Contains(got, expect) {
+			t.Errorf("Invalid content,\nexpected=%v\ngot=%v", expect, got)
+		}
+	}
+	if got := strings.Join(keyMatch.FindAllString(stripComments(got), -1), " "); got != `"ch": "html": "lookup": "printf": "yaml":` {
+		t.Errorf("Invalid keys, got=%v", got)
+	}
+	if strings.Contains(got, `FuncName: "lookup"`) {
+		t.Errorf("A func literal should not have public idents,\n%v", got)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("Expected the hidden key to be skipped, got warnings=%v", res.Warnings)
+	}
+
+	_, err = export.FromFuncMap(map[string]interface{}{"one": 1}, "gen.go", "gen", "tomate")
+	var unsupportedExpr *export.UnsupportedExprError
+	if !errors.As(err, &unsupportedExpr) || unsupportedExpr.Key != "one" {
+		t.Errorf("Expected an UnsupportedExprError of key one, got=%v", err)
+	}
+}
+
+var commentLine = regexp.MustCompile(`(?m)^\s*//.*\n`)
+
+func stripComments(s string) string {
+	return commentLine.ReplaceAllString(s, "")
+}
+
+func formatGoCode(s string) string {
+	fmtExpected, err := format.Source([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return string(fmtExpected)
+}
+
+func TestParseAll(t *testing.T) {
+	targets := export.Targets{}
+	err := targets.Parse([]string{"package", "path/package:*"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got=%v", len(targets))
+	}
+	for _, target := range targets {
+		if len(target.Idents) != 0 {
+			t.Errorf("Expected target %v to have no idents, got=%v", target.PkgPath, target.Idents)
+		}
+	}
+	if err := targets.Parse([]string{"package:"}); err == nil {
+		t.Errorf("Expected an error for an empty ident")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tpkg := "github.com/mh-cbon/export-funcmap/test"
+	prog, err := export.GetProgram([]string{tpkg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idents, warnings, err := export.Discover(prog, tpkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idents) != 2 || idents[0] != "k" || idents[1] != "k2" {
+		t.Errorf("Expected idents=[k k2], got=%v", idents)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got=%v", warnings)
+	}
+
+	// the maps that are not funcmaps are skipped.
+	tpkg = "github.com/mh-cbon/export-funcmap/export/test"
+	prog, err = export.GetProgram([]string{tpkg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idents, warnings, err = export.Discover(prog, tpkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, ident := range idents {
+		found[ident] = true
+	}
+	if !found["stringfn"] || !found["registeredfn"] || found["unassignedfn"] || found["notFuncfn"] {
+		t.Errorf("Expected funcmap idents only, got=%v", idents)
+	}
+	skipped := strings.Join(warnings, "\n")
+	for _, want := range []string{
+		tpkg + ":unassignedfn is skipped, unassignedfn of " + tpkg + ":unassignedfn is never assigned a funcmap",
+		tpkg + ":notFuncfn is skipped, value of key \"fn\" of " + tpkg + ":notFuncfn is not a function",
+	} {
+		if !strings.Contains(skipped, want) {
+			t.Errorf("Expected a warning %q, got=%v", want, warnings)
+		}
+	}
+}
+
+func TestUnexported(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"unexportedStructfn"},
+	}}
+
+	datas := []struct {
+		policy         export.UnexportedPolicy
+		expectErr      bool
+		expectWarnings int
+		expectContents string
+	}{
+		{policy: export.UnexportedError, expectErr: true},
+		{
+			policy: export.UnexportedInterface,
+			expectContents: `"fn": func(g string) a.Namer {
+		return nil
+	},`,
+		},
+		{
+			policy: export.UnexportedUnderlying,
+			expectContents: `"fn": func(g string) struct {
+		Value string
+	} {
+		return struct {
+			Value string
+		}{}
+	},`,
+		},
+		{
+			policy: export.UnexportedEmptyInterface,
+			expectContents: `"fn": func(g string) interface {
+	} {
+		return nil
+	},`,
+		},
+		{
+			policy:         export.UnexportedSkip,
+			expectWarnings: 1,
+			expectContents: `{
+	// "ok" is a func literal, at github.com/mh-cbon/export-funcmap/export/test/test.go:211.
+	"ok": func(g string) string {`,
+		},
+	}
+
+	for _, data := range datas {
+		conf := export.Config{Unexported: data.policy}
+		res, err := conf.Export(targets, "gen.go", "gen", "tomate")
+		if data.expectErr {
+			if err == nil {
+				t.Errorf("Test %v: Expected an error, got=%v", data.policy, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Test %v: %v", data.policy, err)
+			continue
+		}
+		if len(res.Warnings) != data.expectWarnings {
+			t.Errorf("Test %v: Expected %v warnings, got=%v", data.policy, data.expectWarnings, res.Warnings)
+		}
+		var b bytes.Buffer
+		export.PrintAstFile(&b, res.File)
+		if !strings.Contains(b.String(), data.expectContents) {
+			t.Errorf(
+				"Test %v: Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v",
+				data.policy, data.expectContents, b.String(),
+			)
+		}
+	}
+}
+
+func TestUnexportedPublicIdents(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"publicUnexportedfn"},
+	}}
+
+	// the public idents have the signature of the symbolic funcmap.
+	datas := []struct {
+		policy         export.UnexportedPolicy
+		expectContents []string
+	}{
+		{
+			policy: export.UnexportedInterface,
+			expectContents: []string{
+				`"namer": func(v string) a.Namer {`,
+				`Signature: "func(v string) a.Namer"`,
+			},
+		},
+		{
+			policy: export.UnexportedEmptyInterface,
+			expectContents: []string{
+				`"namer": func(v string) interface {`,
+				`Signature: "func(v string) interface{}"`,
+			},
+		},
+	}
+
+	for _, data := range datas {
+		res, err := export.Config{Unexported: data.policy}.Export(targets, "gen.go", "gen", "tomate")
+		if err != nil {
+			t.Fatalf("Test %v: %v", data.policy, err)
+		}
+		var b bytes.Buffer
+		export.PrintAstFile(&b, res.File)
+		for _, expect := range data.expectContents {
+			if !strings.Contains(b.String(), expect) {
+				t.Errorf(
+					"Test %v: Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v",
+					data.policy, expect, b.String(),
+				)
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tpkg := "github.com/mh-cbon/export-funcmap/export/test"
+	targets := export.Targets{{
+		PkgPath: tpkg,
+		Idents:  []string{"manyArgsEllipsisfn", "templatesfn", "genericfn"},
+	}}
+
+	desc, err := export.Config{Merge: export.MergePrefix}.Describe(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desc.Funcs) != 5 {
+		t.Fatalf("Expected 5 funcs, got=%v", len(desc.Funcs))
+	}
+	if len(desc.Vars) != 3 {
+		t.Errorf("Expected 3 vars, got=%v", desc.Vars)
+	}
+	if len(desc.Conflicts) != 1 || desc.Funcs[1].Name != "templatesfn_fn" {
+		t.Errorf("Expected the key fn of templatesfn to be prefixed, got=%v", desc.Conflicts)
+	}
+
+	fn := desc.Funcs[0]
+	got := fmt.Sprintf("%v %v %v %v", fn.Name, fn.Params, fn.Results, fn.Variadic)
+	expect := "fn [{k int  int} {g ...string  string}] [{ string  string}] true"
+	if got != expect {
+		t.Errorf("Invalid description,\nexpected=%v\ngot=%v", expect, got)
+	}
+	if fn.Funcmap != tpkg+":manyArgsEllipsisfn" || fn.Sel != "" || fn.Pos.Line == 0 {
+		t.Errorf("Invalid origin of %v", fn)
+	}
+
+	fn = desc.Funcs[1]
+	got = fmt.Sprintf("%v %v", fn.Params, fn.Results)
+	expect = "[{g template.HTML html/template string}] [{ *template.Template text/template ptr}]"
+	if got != expect {
+		t.Errorf("Invalid description,\nexpected=%v\ngot=%v", expect, got)
+	}
+
+	fn = desc.Funcs[4]
+	if fn.Name != "pair" || fn.Sel != "a.MakePair" || fn.Pkg != tpkg {
+		t.Errorf("Invalid origin of %v", fn)
+	}
+	if fn.Decl == fn.Pos || filepath.Base(fn.Decl.Filename) != "test.go" || !strings.HasPrefix(fn.Doc, "MakePair") {
+		t.Errorf("Invalid declaration of %v, decl=%v doc=%q", fn.Name, fn.Decl, fn.Doc)
+	}
+}
+
+func TestPublicIdents(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"genericfn"},
+	}}
+	res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	export.PrintAstFile(&b, res.File)
+	str := b.String()
+
+	expects := []string{
+		`"github.com/mh-cbon/export-funcmap/funcinfo"`,
+		"var tomatePublic = []funcinfo.FuncInfo{\n\t{FuncName: \"keys\", Sel: \"maps.Keys\", Pkg: \"maps\", PkgName: \"maps\", Signature: \"func(m map[string]int) iter.Seq[string]\"",
+		"\n\t" + `{FuncName: "pair", Sel: "a.MakePair", Pkg: "github.com/mh-cbon/export-funcmap/export/test", PkgName: "a", Signature: "func(k string, v a.SomeStruct) a.Pair[string, a.SomeStruct]", Pos: "github.com/mh-cbon/export-funcmap/export/test/test.go:`,
+	}
+	for _, expect := range expects {
+		if !strings.Contains(str, expect) {
+			t.Errorf("Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", expect, str)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"templatesfn"},
+	}}
+	res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "gen.go")
+	if err := export.WriteFile(filename, res.File); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := export.GeneratedHeader + `
+
+package gen
+
+import (
+	"html/template"
+	texttemplate "text/template"
+
+	"github.com/mh-cbon/export-funcmap/funcinfo"
+)
+`
+	if !strings.HasPrefix(string(b), expect) {
+		t.Errorf("Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", expect, string(b))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	export.EnableCache = false
+
+	tpkg := "github.com/mh-cbon/export-funcmap/export/test"
+	bools, err := export.Config{}.Export(export.Targets{{PkgPath: tpkg, Idents: []string{"boolfn"}}}, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "gen.go")
+	if err := export.WriteFile(filename, bools.File); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := export.Verify(filename, bools.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("Expected an empty diff, got=\n%v", diff)
+	}
+
+	strs, err := export.Config{}.Export(export.Targets{{PkgPath: tpkg, Idents: []string{"stringfn"}}}, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err = export.Verify(filename, strs.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `@@ tomate @@
+-"fn": func(g bool) bool
++"fn": func(g string) string
+`
+	if !strings.HasSuffix(diff, expect) {
+		t.Errorf("Invalid diff,\nexpected=\n%v\n\ngot=\n%v", expect, diff)
+	}
+
+	missing := filepath.Join(t.TempDir(), "gen.go")
+	diff, err = export.Verify(missing, bools.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "--- " + missing + " (missing)\n+++ " + missing + " (export)\n" + `@@ tomate @@
++"fn": func(g bool) bool
+`
+	if diff != expect {
+		t.Errorf("Invalid diff of a missing file,\nexpected=\n%v\n\ngot=\n%v", expect, diff)
+	}
+
+	// the public idents are compared too.
+	publics, err := export.Config{}.Export(export.Targets{{PkgPath: tpkg, Idents: []string{"genericfn"}}}, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := export.WriteFile(filename, publics.File); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(string(b), `Sel: "a.MakePair"`, `Sel: "a.OtherPair"`, 1)
+	if err := os.WriteFile(filename, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = export.Verify(filename, publics.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "@@ tomatePublic @@\n-\"pair\": {FuncName: \"pair\", Sel: \"a.OtherPair\"") ||
+		!strings.Contains(diff, "+\"pair\": {FuncName: \"pair\", Sel: \"a.MakePair\"") {
+		t.Errorf("Invalid diff of the public idents, got=\n%v", diff)
+	}
+
+	// the positions are not compared.
+	moved := regexp.MustCompile(`Pos: "[^"]*"`).ReplaceAllString(string(b), `Pos: "moved.go:1:1"`)
+	if moved == string(b) {
+		t.Fatalf("Expected positions in the public idents, got=\n%v", moved)
+	}
+	if err := os.WriteFile(filename, []byte(moved), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = export.Verify(filename, publics.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("Expected no diff of the positions, got=\n%v", diff)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	export.EnableCache = false
+
+	tpkg := "github.com/mh-cbon/export-funcmap/export/test"
+	exportVar := func(ident string) error {
+		_, err := export.Config{}.Export(export.Targets{{PkgPath: tpkg, Idents: []string{ident}}}, "gen.go", "gen", "tomate")
+		return err
+	}
+
+	err := exportVar("nope")
+	var notFound *export.TargetNotFoundError
+	if !errors.As(err, &notFound) || notFound.PkgPath != tpkg || notFound.Var != "nope" {
+		t.Errorf("Expected a TargetNotFoundError, got=%#v", err)
+	}
+
+	err = exportVar("typeUnexportedfn")
+	var unsupportedType *export.UnsupportedTypeError
+	if !errors.As(err, &unsupportedType) || unsupportedType.Var != "typeUnexportedfn" || unsupportedType.Key != "fn" || unsupportedType.Pos.Line == 0 {
+		t.Errorf("Expected an UnsupportedTypeError, got=%#v", err)
+	}
+
+	err = exportVar("unsupportedExprfn")
+	var unsupportedExpr *export.UnsupportedExprError
+	if !errors.As(err, &unsupportedExpr) || unsupportedExpr.Var != "unsupportedExprfn" || unsupportedExpr.Expr != `someFuncMaps["x"]` {
+		t.Errorf("Expected an UnsupportedExprError, got=%#v", err)
+	}
+
+	err = exportVar("unassignedfn")
+	if !errors.As(err, &unsupportedExpr) || unsupportedExpr.Var != "unassignedfn" || unsupportedExpr.Reason != "is never assigned a funcmap" {
+		t.Errorf("Expected an UnsupportedExprError, got=%#v", err)
+	}
+
+	err = exportVar("tuplefn")
+	if !errors.As(err, &unsupportedExpr) || unsupportedExpr.Var != "tuplefn" || unsupportedExpr.Expr != "funcAndCount()" {
+		t.Errorf("Expected an UnsupportedExprError, got=%#v", err)
+	}
+
+	err = exportVar("notFuncfn")
+	if !errors.As(err, &unsupportedExpr) || unsupportedExpr.Var != "notFuncfn" || unsupportedExpr.Key != "fn" || unsupportedExpr.Reason == "" {
+		t.Errorf("Expected an UnsupportedExprError, got=%#v", err)
+	} else if expect := "value of key \"fn\" of " + tpkg + ":notFuncfn is not a function at "; !strings.HasPrefix(err.Error(), expect) {
+		t.Errorf("Invalid message,\nexpected=%v\ngot=%v", expect, err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	export.EnableCache = false
+
+	tpkg := "github.com/mh-cbon/export-funcmap/export/test"
+	files := map[string]string{
+		"jobs.yml": `
+jobs:
+- out: a/gen.go
+  package: a
+  var: funcs
+  targets: [` + tpkg + `:boolfn]
+- out: b/gen.go
+  package: b
+  var: funcs
+  split: true
+  unexported: skip
+  targets: [` + tpkg + `:stringfn:unexportedStructfn]
+`,
+		"jobs.json": `{"jobs": [
+{"out": "a/gen.go", "package": "a", "var": "funcs", "targets": ["` + tpkg + `:boolfn"]},
+{"out": "b/gen.go", "package": "b", "var": "funcs", "split": true, "unexported": "skip",
+ "targets": ["` + tpkg + `:stringfn:unexportedStructfn"]}
+]}`,
+		"jobs.toml": `
+[[jobs]]
+out = "a/gen.go"
+package = "a"
+var = "funcs"
+targets = ["` + tpkg + `:boolfn"]
+
+[[jobs]]
+out = "b/gen.go"
+package = "b"
+var = "funcs"
+split = true
+unexported = "skip"
+targets = ["` + tpkg + `:stringfn:unexportedStructfn"]
+`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := export.LoadJobs(filename)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if len(jobs.Jobs) != 2 || jobs.Jobs[1].Out != filepath.Join(dir, "b/gen.go") {
+			t.Fatalf("%v: Invalid jobs %v", name, jobs.Jobs)
+		}
+
+		results, err := jobs.Export()
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		got := fmt.Sprint(results[0].Vars, results[1].Vars, len(results[1].Warnings))
+		expect := fmt.Sprintf("[%v:boolfn => funcs] [%v:stringfn => funcsStringfn %v:unexportedStructfn => funcsUnexportedStructfn] 1", tpkg, tpkg, tpkg)
+		if got != expect {
+			t.Errorf("%v: Invalid results,\nexpected=%v\ngot=%v", name, expect, got)
+		}
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	export.EnableCache = false
+
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"genericfn"},
+	}}
+	res, err := export.Config{}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	export.PrintAstFile(&b, res.File)
+	str := b.String()
+
+	expects := []string{
+		`	// "keys" is maps.Keys[map[string]int] of maps, at maps/iter.go:`,
+		`	// Keys returns an iterator over keys in m.`,
+		`	// "pair" is MakePair[string, SomeStruct] of github.com/mh-cbon/export-funcmap/export/test, at github.com/mh-cbon/export-funcmap/export/test/test.go:268.
+	//
+	// MakePair is a generic function.
+	"pair": func(`,
+	}
+	for _, expect := range expects {
+		if !strings.Contains(str, expect) {
+			t.Errorf("Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", expect, str)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	export.EnableCache = false
+
+	tpkg := "github.com/mh-cbon/export-funcmap/test"
+	targets := export.Targets{{PkgPath: tpkg, Idents: []string{"k", "k2"}}}
+
+	datas := []struct {
+		policy         export.MergePolicy
+		expectErr      bool
+		expectContents []string
+	}{
+		{
+			policy:         export.MergeLastWins,
+			expectContents: []string{`"dup": func(g string) string {`},
+		},
+		{
+			policy:         export.MergeFirstWins,
+			expectContents: []string{`"dup": func(g int8) int8 {`},
+		},
+		{
+			policy: export.MergePrefix,
+			expectContents: []string{
+				`"dup": func(g int8) int8 {`,
+				`"k2_dup": func(g string) string {`,
+			},
+		},
+		{policy: export.MergeError, expectErr: true},
+	}
+
+	for _, data := range datas {
+		res, err := export.Config{Merge: data.policy}.Export(targets, "gen.go", "gen", "tomate")
+		if data.expectErr {
+			var conflict *export.KeyConflictError
+			if !errors.As(err, &conflict) || len(conflict.Conflicts) != 7 {
+				t.Errorf("Test %v: Expected a KeyConflictError, got=%v", data.policy, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Test %v: %v", data.policy, err)
+			continue
+		}
+
+		// a, b, c, yy, zz, g and dup
+		if len(res.Conflicts) != 7 {
+			t.Errorf("Test %v: Expected 7 conflicts, got=%v", data.policy, res.Conflicts)
+		}
+		c := res.Conflicts[len(res.Conflicts)-1]
+		if c.Key != "dup" || c.First.Var != "k" || c.Second.Var != "k2" || c.First.Pos.Line != 32 || c.Second.Pos.Line != 47 {
+			t.Errorf("Test %v: Invalid conflict %v", data.policy, c)
+		}
+
+		var b bytes.Buffer
+		export.PrintAstFile(&b, res.File)
+		for _, expect := range data.expectContents {
+			if !strings.Contains(b.String(), expect) {
+				t.Errorf("Test %v: Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", data.policy, expect, b.String())
+			}
+		}
+	}
+
+	// a copied funcmap sets the same values, it does not conflict.
+	tpkg = "github.com/mh-cbon/export-funcmap/export/test"
+	targets = export.Targets{{PkgPath: tpkg, Idents: []string{"basefn", "copiedbasefn"}}}
+	res, err := export.Config{Merge: export.MergeError}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got=%v", res.Conflicts)
+	}
+
+	// the prefixed keys that are taken are numbered.
+	targets = export.Targets{{PkgPath: tpkg, Idents: []string{"prefixedfn", "dupfn"}}}
+	res, err = export.Config{Merge: export.MergePrefix}.Export(targets, "gen.go", "gen", "tomate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	export.PrintAstFile(&b, res.File)
+	for _, expect := range []string{
+		`"dupfn_fn": func(g string) string {`,
+		`"a_dupfn_fn": func(g string) string {`,
+		`"a_dupfn_fn_2": func(g int) int {`,
+	} {
+		if !strings.Contains(b.String(), expect) {
+			t.Errorf("Invalid content did not match,\nexpected=\n%v\n\ngot=\n%v", expect, b.String())
+		}
+	}
+}
+
+func TestDescribeStdlib(t *testing.T) {
+	targets := export.Targets{{
+		PkgPath: "github.com/mh-cbon/export-funcmap/export/test",
+		Idents:  []string{"stdlibfn"},
+	}}
+
+	desc, err := export.Config{}.Describe(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desc.Funcs) != 1 {
+		t.Fatalf("Expected 1 func, got=%v", len(desc.Funcs))
+	}
+	fn := desc.Funcs[0]
+	if fn.Sel != "strings.ToUpper" || fn.Pkg != "strings" {
+		t.Errorf("Invalid origin of %v", fn)
+	}
+	decl := fn.Decl.Filename
+	if strings.Contains(decl, "$GOROOT") || !filepath.IsAbs(decl) || filepath.Base(decl) != "strings.go" || fn.Decl.Line == 0 {
+		t.Errorf("Invalid declaration of %v, decl=%v", fn.Name, fn.Decl)
+	}
+	if _, err := os.Stat(decl); err != nil {
+		t.Errorf("Invalid declaration of %v, %v", fn.Name, err)
+	}
+	if !strings.HasPrefix(fn.Doc, "ToUpper") {
+		t.Errorf("Invalid doc of %v, doc=%q", fn.Name, fn.Doc)
 	}
-	return string(fmtExpected)
 }
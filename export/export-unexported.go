@@ -0,0 +1,219 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"go/types"
+)
+
+// UnexportedPolicy tells how to export a signature
+// using a type that is unexported in its package.
+type UnexportedPolicy int
+
+const (
+	// UnexportedError fails the export.
+	UnexportedError UnexportedPolicy = iota
+	// UnexportedInterface replaces the type with the exported interface
+	// of its package it implements with the most methods,
+	// or with interface{} when there is none.
+	UnexportedInterface
+	// UnexportedUnderlying replaces the type with its underlying type.
+	UnexportedUnderlying
+	// UnexportedEmptyInterface replaces the type with interface{}.
+	UnexportedEmptyInterface
+	// UnexportedSkip skips the funcmap entry with a warning.
+	UnexportedSkip
+)
+
+var unexportedPolicyNames = map[UnexportedPolicy]string{
+	UnexportedError:          "error",
+	UnexportedInterface:      "interface",
+	UnexportedUnderlying:     "underlying",
+	UnexportedEmptyInterface: "any",
+	UnexportedSkip:           "skip",
+}
+
+func (p UnexportedPolicy) String() string {
+	return unexportedPolicyNames[p]
+}
+
+// ParseUnexportedPolicy returns the policy of given name,
+// one of error, interface, underlying, any or skip.
+func ParseUnexportedPolicy(s string) (UnexportedPolicy, error) {
+	for p, name := range unexportedPolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return UnexportedError, fmt.Errorf("Invalid unexported policy: %v", s)
+}
+
+// errSkip is returned when a type can not be rendered
+// and its funcmap entry must be skipped.
+var errSkip = errors.New("skip")
+
+// unexportedType returns the type to render in place of m,
+// according to the unexported policy.
+func (r *typeRenderer) unexportedType(m *types.Named) (types.Type, error) {
+	switch r.unexported {
+	case UnexportedInterface:
+		if iface := nearestInterface(m); iface != nil {
+			return iface, nil
+		}
+		return types.NewInterfaceType(nil, nil), nil
+	case UnexportedUnderlying:
+		return m.Underlying(), nil
+	case UnexportedEmptyInterface:
+		return types.NewInterfaceType(nil, nil), nil
+	case UnexportedSkip:
+		return nil, errSkip
+	}
+	return nil, fmt.Errorf("Cannot use unexported type %v", m)
+}
+
+// nearestInterface returns the exported interface of the package of m,
+// or error, that m implements with the most methods.
+func nearestInterface(m *types.Named) *types.Named {
+	var candidates []*types.Named
+	scope := m.Obj().Pkg().Scope()
+	names := scope.Names() // sorted
+	for _, name := range names {
+		if tn, ok := scope.Lookup(name).(*types.TypeName); ok && tn.Exported() {
+			if n, ok := tn.Type().(*types.Named); ok && n.TypeParams().Len() == 0 {
+				candidates = append(candidates, n)
+			}
+		}
+	}
+	candidates = append(candidates, types.Universe.Lookup("error").Type().(*types.Named))
+
+	var ret *types.Named
+	for _, c := range candidates {
+		iface, ok := c.Underlying().(*types.Interface)
+		if !ok || !iface.IsMethodSet() || iface.NumMethods() == 0 {
+			continue
+		}
+		if types.Implements(m, iface) && (ret == nil || iface.NumMethods() > ret.Underlying().(*types.Interface).NumMethods()) {
+			ret = c
+		}
+	}
+	return ret
+}
+
+// policyType returns t with the types unexported in their package
+// replaced according to the unexported policy,
+// as the symbolic funcmap renders them.
+func (r *typeRenderer) policyType(t types.Type) (types.Type, error) {
+	switch m := t.(type) {
+	case *types.Alias:
+		return r.policyType(types.Unalias(m))
+
+	case *types.Named:
+		if m.Obj().Pkg() == nil { // error, comparable
+			return m, nil
+		}
+		if !m.Obj().Exported() {
+			u, err := r.unexportedType(m)
+			if err != nil {
+				return nil, err
+			}
+			return r.policyType(u)
+		}
+		if m.TypeArgs().Len() == 0 {
+			return m, nil
+		}
+		var args []types.Type
+		for i := 0; i < m.TypeArgs().Len(); i++ {
+			arg, err := r.policyType(m.TypeArgs().At(i))
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return types.Instantiate(nil, m.Origin(), args, false)
+
+	case *types.Pointer:
+		elem, err := r.policyType(m.Elem())
+		return types.NewPointer(elem), err
+
+	case *types.Slice:
+		elem, err := r.policyType(m.Elem())
+		return types.NewSlice(elem), err
+
+	case *types.Array:
+		elem, err := r.policyType(m.Elem())
+		return types.NewArray(elem, m.Len()), err
+
+	case *types.Map:
+		key, err := r.policyType(m.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := r.policyType(m.Elem())
+		return types.NewMap(key, elem), err
+
+	case *types.Chan:
+		elem, err := r.policyType(m.Elem())
+		return types.NewChan(m.Dir(), elem), err
+
+	case *types.Signature:
+		params, err := r.policyTuple(m.Params())
+		if err != nil {
+			return nil, err
+		}
+		results, err := r.policyTuple(m.Results())
+		if err != nil {
+			return nil, err
+		}
+		return types.NewSignatureType(nil, nil, nil, params, results, m.Variadic()), nil
+
+	case *types.Struct:
+		var fields []*types.Var
+		var tags []string
+		for i := 0; i < m.NumFields(); i++ {
+			f := m.Field(i)
+			ft, err := r.policyType(f.Type())
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, types.NewField(f.Pos(), f.Pkg(), f.Name(), ft, f.Embedded()))
+			tags = append(tags, m.Tag(i))
+		}
+		return types.NewStruct(fields, tags), nil
+
+	case *types.Interface:
+		var methods []*types.Func
+		for i := 0; i < m.NumExplicitMethods(); i++ {
+			method := m.ExplicitMethod(i)
+			sig, err := r.policyType(method.Type())
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, types.NewFunc(method.Pos(), method.Pkg(), method.Name(), sig.(*types.Signature)))
+		}
+		var embeddeds []types.Type
+		for i := 0; i < m.NumEmbeddeds(); i++ {
+			e, err := r.policyType(m.EmbeddedType(i))
+			if err != nil {
+				return nil, err
+			}
+			embeddeds = append(embeddeds, e)
+		}
+		return types.NewInterfaceType(methods, embeddeds).Complete(), nil
+	}
+	return t, nil
+}
+
+// policyTuple returns the tuple with the types of its variables
+// replaced according to the unexported policy.
+func (r *typeRenderer) policyTuple(tuple *types.Tuple) (*types.Tuple, error) {
+	var vars []*types.Var
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		t, err := r.policyType(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, types.NewParam(v.Pos(), v.Pkg(), v.Name(), t))
+	}
+	return types.NewTuple(vars...), nil
+}
@@ -0,0 +1,225 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Verify compares the signatures of the funcmaps of file,
+// and the FuncInfo of their public idents but their Pos,
+// to the ones of the generated file already written to filename.
+// It returns a unified diff of the added, removed and changed signatures,
+// the diff is empty when filename is up to date.
+// A missing filename is not up to date, its diff adds every signature.
+func Verify(filename string, file *ast.File) (string, error) {
+	src, err := Format(filename, file)
+	if err != nil {
+		return "", err
+	}
+	want, err := parseSignatures(filename+" (export)", src)
+	if err != nil {
+		return "", err
+	}
+
+	cur, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		hunks := diffSignatures(funcmapSignatures{}, want)
+		return "--- " + filename + " (missing)\n+++ " + filename + " (export)\n" + hunks, nil
+	} else if err != nil {
+		return "", err
+	}
+	got, err := parseSignatures(filename, cur)
+	if err != nil {
+		return "", err
+	}
+
+	hunks := diffSignatures(got, want)
+	if hunks == "" {
+		return "", nil
+	}
+	return "--- " + filename + "\n+++ " + filename + " (export)\n" + hunks, nil
+}
+
+// funcmapSignatures are the signatures of the keys of funcmap variables,
+// and the FuncInfo literals of the public idents variables by FuncName,
+// in the order of declaration of the variables.
+type funcmapSignatures struct {
+	vars []string
+	sigs map[string]map[string]string
+}
+
+// parseSignatures parses the source of a generated file
+// to read the signatures of its funcmap variables.
+func parseSignatures(filename string, src []byte) (funcmapSignatures, error) {
+	ret := funcmapSignatures{sigs: map[string]map[string]string{}}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vspec := spec.(*ast.ValueSpec)
+			for i, name := range vspec.Names {
+				if i >= len(vspec.Values) {
+					break
+				}
+				lit, ok := vspec.Values[i].(*ast.CompositeLit)
+				if !ok {
+					continue
+				}
+				if _, ok := lit.Type.(*ast.ArrayType); ok {
+					infos, err := parseFuncInfos(fset, lit)
+					if err != nil {
+						return ret, err
+					}
+					ret.vars = append(ret.vars, name.Name)
+					ret.sigs[name.Name] = infos
+					continue
+				}
+				if _, ok := lit.Type.(*ast.MapType); !ok {
+					continue
+				}
+				sigs := map[string]string{}
+				for _, elt := range lit.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					key, ok := kv.Key.(*ast.BasicLit)
+					if !ok || key.Kind != token.STRING {
+						continue
+					}
+					fn, ok := kv.Value.(*ast.FuncLit)
+					if !ok {
+						continue
+					}
+					k, err := strconv.Unquote(key.Value)
+					if err != nil {
+						return ret, err
+					}
+					var b bytes.Buffer
+					if err := format.Node(&b, fset, fn.Type); err != nil {
+						return ret, err
+					}
+					sigs[k] = b.String()
+				}
+				ret.vars = append(ret.vars, name.Name)
+				ret.sigs[name.Name] = sigs
+			}
+		}
+	}
+	return ret, nil
+}
+
+// funcInfoFields are the fields of FuncInfo compared by Verify,
+// Pos is left out, it changes with the versions of the packages.
+var funcInfoFields = []string{"FuncName", "Sel", "Pkg", "Signature"}
+
+// parseFuncInfos reads the FuncInfo literals of a public idents variable,
+// by their FuncName, as the text of their compared fields.
+func parseFuncInfos(fset *token.FileSet, lit *ast.CompositeLit) (map[string]string, error) {
+	infos := map[string]string{}
+	for _, elt := range lit.Elts {
+		info, ok := elt.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		values := map[string]ast.Expr{}
+		for _, field := range info.Elts {
+			kv, ok := field.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok {
+				values[key.Name] = kv.Value
+			}
+		}
+		v, ok := values["FuncName"].(*ast.BasicLit)
+		if !ok || v.Kind != token.STRING {
+			continue
+		}
+		funcName, err := strconv.Unquote(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		var fields []string
+		for _, name := range funcInfoFields {
+			value, ok := values[name]
+			if !ok {
+				continue
+			}
+			var b bytes.Buffer
+			if err := format.Node(&b, fset, value); err != nil {
+				return nil, err
+			}
+			fields = append(fields, name+": "+b.String())
+		}
+		infos[funcName] = "{" + strings.Join(fields, ", ") + "}"
+	}
+	return infos, nil
+}
+
+// diffSignatures writes the hunks of a unified diff
+// of the signatures got and want.
+func diffSignatures(got, want funcmapSignatures) string {
+	vars := append([]string{}, got.vars...)
+	for _, v := range want.vars {
+		if _, ok := got.sigs[v]; !ok {
+			vars = append(vars, v)
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		var hunk []string
+		for _, key := range mergedKeys(got.sigs[v], want.sigs[v]) {
+			g, inGot := got.sigs[v][key]
+			w, inWant := want.sigs[v][key]
+			if inGot && inWant && g == w {
+				continue
+			}
+			if inGot {
+				hunk = append(hunk, "-"+strconv.Quote(key)+": "+g)
+			}
+			if inWant {
+				hunk = append(hunk, "+"+strconv.Quote(key)+": "+w)
+			}
+		}
+		if len(hunk) > 0 {
+			fmt.Fprintf(&b, "@@ %v @@\n", v)
+			b.WriteString(strings.Join(hunk, "\n") + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// mergedKeys returns the sorted keys of both maps.
+func mergedKeys(a, b map[string]string) []string {
+	var ret []string
+	for k := range a {
+		ret = append(ret, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
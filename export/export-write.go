@@ -0,0 +1,64 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/imports"
+)
+
+// GeneratedHeader is the comment heading the generated files,
+// it marks them as generated for the go tools.
+const GeneratedHeader = "// Code generated by export-funcmap. DO NOT EDIT."
+
+// Format returns the source of the file,
+// headed by GeneratedHeader and formatted as goimports does.
+func Format(filename string, file *ast.File) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(GeneratedHeader + "\n\n")
+	if err := PrintAstFile(&b, file); err != nil {
+		return nil, err
+	}
+	out, err := imports.Process(filename, b.Bytes(), &imports.Options{
+		FormatOnly: true,
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   8,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %v: %v", filename, err)
+	}
+	return out, nil
+}
+
+// WriteFile formats the file and writes it to filename.
+// The file is written to a temporary file first,
+// then renamed, so that filename is never left half written.
+func WriteFile(filename string, file *ast.File) error {
+	src, err := Format(filename, file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	// the temporary file is gone once renamed.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
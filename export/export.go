@@ -1,52 +1,215 @@
 package export
 
 import (
+	"bytes"
+	"fmt"
 	"go/ast"
+	"strings"
 )
 
+// Config holds the options of an export.
+type Config struct {
+	// BuildFlags are passed to the go command when the packages are loaded.
+	BuildFlags []string
+	// Split exports each funcmap variable into its own output variable,
+	// rather than merging them all into one.
+	Split bool
+	// Unexported tells how to export signatures using unexported types.
+	Unexported UnexportedPolicy
+	// Merge tells how to merge a key set by several funcmaps
+	// exported into the same variable.
+	Merge MergePolicy
+	// Prog is the program the packages are loaded into,
+	// it lets many exports share their packages.
+	// When it is nil, each export loads its own program with BuildFlags.
+	Prog *Program
+}
+
+// ExportedVar describes a funcmap variable picked up by an export.
+type ExportedVar struct {
+	PkgPath string `json:"pkgPath"`
+	Ident   string `json:"ident"`
+	// OutVar is the output variable receiving the funcmap.
+	OutVar string `json:"outVar,omitempty"`
+}
+
+func (e ExportedVar) String() string {
+	return e.PkgPath + ":" + e.Ident + " => " + e.OutVar
+}
+
+// Result is the outcome of an export.
+type Result struct {
+	File *ast.File
+	// Vars lists the exported funcmap variables.
+	Vars []ExportedVar
+	// Warnings about the funcmap variables and entries that were skipped,
+	// and the renamed keys that do not exist.
+	Warnings []string
+	// Conflicts lists the keys set by several funcmaps.
+	Conflicts []Conflict
+}
+
 // Export exports symbolic and public idents information of targets.
-func Export(targets Targets, outfilename, outpackage, outvarname string) (*ast.File, error) {
+// buildFlags are passed to the go command when the packages are loaded.
+func Export(targets Targets, outfilename, outpackage, outvarname string, buildFlags ...string) (*ast.File, error) {
 
-	// gather all targeted packages
-	targetPackages := targets.GetPackagePaths()
+	cacheKey := fmt.Sprintf("%v %v %v %v %v", targets, outfilename, outpackage, outvarname, buildFlags)
 
 	// is it already processed ?
-	if f := getCached(targetPackages); f != nil {
+	if f := getCached(cacheKey); f != nil {
 		// yup.
 		return f, nil
 	}
 
-	// make a program of them
-	prog, err := GetProgram(targetPackages)
+	res, err := Config{BuildFlags: buildFlags}.Export(targets, outfilename, outpackage, outvarname)
 	if err != nil {
 		return nil, err
 	}
 
-	// create a new file of a package.
-	_, destFile := NewPkg(outfilename, outpackage)
+	storeCached(cacheKey, res.File)
 
-	// generate the symbolic expression of the funcmap as a declaration
-	// as a var xx map[string]interface{} = map[string]interface{}{...}
-	mapVar, imported, err := Symbolic(targets, outvarname, prog, destFile)
+	return res.File, nil
+}
+
+// ExportPackage exports every funcmap variable declared at the package level of pkgPath.
+func (c Config) ExportPackage(pkgPath, outfilename, outpackage, outvarname string) (*Result, error) {
+	return c.Export(Targets{{PkgPath: pkgPath}}, outfilename, outpackage, outvarname)
+}
+
+// Export exports symbolic and public idents information of targets.
+// Targets without idents export every funcmap variable of their package.
+func (c Config) Export(targets Targets, outfilename, outpackage, outvarname string) (*Result, error) {
+
+	// make a program of all targeted packages
+	prog, err := c.program(targets)
 	if err != nil {
 		return nil, err
 	}
 
-	publicIdents, err := PublicIdents(targets, outvarname+"Public", prog, destFile)
+	// find the variables of targets without idents.
+	targets, warnings, err := targets.Expand(prog)
 	if err != nil {
 		return nil, err
 	}
 
+	// create a new file of a package.
+	_, destFile := NewPkg(outfilename, outpackage)
+	res := &Result{File: destFile}
+
+	// each group of targets is exported into its own variable.
+	groups := []Targets{targets}
+	varnames := []string{outvarname}
+	if c.Split {
+		groups, varnames = splitTargets(prog, targets, outvarname)
+	}
+
+	r := &typeRenderer{file: destFile, unexported: c.Unexported}
+	var decls []ast.Decl
+	for i, group := range groups {
+		entries, w, err := collectEntries(prog, group)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, w...)
+		entries, conflicts, err := mergeEntries(prog, entries, c.Merge)
+		if err != nil {
+			return nil, err
+		}
+		res.Conflicts = append(res.Conflicts, conflicts...)
+
+		// generate the symbolic expression of the funcmap as a declaration
+		// as a var xx map[string]interface{} = map[string]interface{}{...}
+		mapVar, rendered, err := symbolicDecl(prog, entries, varnames[i], r)
+		if err != nil {
+			return nil, err
+		}
+
+		// skipped entries are left out of the public idents too.
+		publicIdents, err := publicIdentsDecl(rendered, varnames[i]+"Public", r)
+		if err != nil {
+			return nil, err
+		}
+
+		decls = append(decls, mapVar, publicIdents)
+
+		for _, target := range group {
+			for _, ident := range target.Idents {
+				res.Vars = append(res.Vars, ExportedVar{
+					PkgPath: target.PkgPath,
+					Ident:   ident,
+					OutVar:  varnames[i],
+				})
+			}
+		}
+	}
+
+	res.Warnings = append(warnings, r.warnings...)
+
 	// create and inject the import statement
-	AddImportDecl(destFile, imported)
+	AddImportDecl(destFile, r.imported)
+
+	// add the new vars to the file.
+	destFile.Decls = append(destFile.Decls, decls...)
+
+	return res, nil
+}
+
+// program returns a program with the packages of targets loaded.
+func (c Config) program(targets Targets) (*Program, error) {
+	if c.Prog == nil {
+		return GetProgram(targets.GetPackagePaths(), c.BuildFlags...)
+	}
+	for _, pkgPath := range targets.GetPackagePaths() {
+		if _, err := c.Prog.LoadPackage(pkgPath); err != nil {
+			return nil, err
+		}
+	}
+	return c.Prog, nil
+}
 
-	// add the new var to the file.
-	destFile.Decls = append(destFile.Decls, mapVar)
-	destFile.Decls = append(destFile.Decls, publicIdents)
+// splitTargets returns one group of targets per variable,
+// along with the name of their output variable.
+// The name is made of outvarname and the variable ident,
+// the package name is added when the ident is exported from multiple packages.
+func splitTargets(prog *Program, targets Targets, outvarname string) ([]Targets, []string) {
+	pkgsOf := map[string]map[string]bool{}
+	for _, target := range targets {
+		for _, ident := range target.Idents {
+			if pkgsOf[ident] == nil {
+				pkgsOf[ident] = map[string]bool{}
+			}
+			pkgsOf[ident][target.PkgPath] = true
+		}
+	}
 
-	storeCached(targetPackages, destFile)
+	var groups []Targets
+	var varnames []string
+	seen := map[string]bool{}
+	for _, target := range targets {
+		for _, ident := range target.Idents {
+			varname := outvarname + upperFirst(ident)
+			if len(pkgsOf[ident]) > 1 {
+				pkgName := prog.Package(target.PkgPath).Types.Name()
+				varname = outvarname + upperFirst(pkgName) + upperFirst(ident)
+			}
+			if seen[target.PkgPath+":"+ident] {
+				continue
+			}
+			seen[target.PkgPath+":"+ident] = true
+			group := target
+			group.Idents = []string{ident}
+			groups = append(groups, Targets{group})
+			varnames = append(varnames, varname)
+		}
+	}
+	return groups, varnames
+}
 
-	return destFile, nil
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
 }
 
 // EnableCache set cache status
@@ -54,28 +217,25 @@ var EnableCache = true
 
 var cached = map[string]*ast.File{}
 
-func getCacheKey(targetPackages []string) string {
-	n := ""
-	for _, t := range targetPackages {
-		n += t + "\n"
-	}
-	return n
-}
-func getCached(targetPackages []string) *ast.File {
+func getCached(key string) *ast.File {
 	if !EnableCache {
 		return nil
 	}
-	key := getCacheKey(targetPackages)
 	if f, ok := cached[key]; ok {
 		// always return a copy.
-		return stringToAst(astNodeToString(f))
+		var b bytes.Buffer
+		if err := PrintAstFile(&b, f); err != nil {
+			return nil
+		}
+		if f, err := stringToAst(b.String()); err == nil {
+			return f
+		}
 	}
 	return nil
 }
 
-func storeCached(targetPackages []string, f *ast.File) {
+func storeCached(key string, f *ast.File) {
 	if EnableCache {
-		key := getCacheKey(targetPackages)
 		cached[key] = f
 	}
 }
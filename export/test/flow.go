@@ -0,0 +1,81 @@
+package a
+
+import (
+	"html/template"
+)
+
+var madefn = make(template.FuncMap)
+
+func init() {
+	madefn["fn"] = func(g string) string { return "" }
+}
+
+func madeFuncMapFn() template.FuncMap {
+	m := make(template.FuncMap, 1)
+	m["fn"] = func(g string) string { return "" }
+	return m
+}
+
+var madecallfn = madeFuncMapFn()
+
+var reassignedfn template.FuncMap
+
+func init() {
+	reassignedfn = template.FuncMap{"fn": func(g string) string { return "" }}
+}
+
+var unassignedfn template.FuncMap
+
+var tuplefn = map[string]interface{}{}
+
+func funcAndCount() (interface{}, int) {
+	return func(g string) string { return "" }, 1
+}
+
+func init() {
+	var n int
+	tuplefn["fn"], n = funcAndCount()
+	_ = n
+}
+
+var resetfn = template.FuncMap{"fn": func(g string) string { return "" }}
+
+// ResetFuncs might never be called, resetfn keeps its entries.
+func ResetFuncs() {
+	resetfn = template.FuncMap{}
+}
+
+var registeredfn = template.FuncMap{}
+
+// Register adds a function at run time, it is not exported.
+func Register(name string, fn interface{}) {
+	registeredfn[name] = fn
+}
+
+var helperfn = template.FuncMap{}
+
+func init() {
+	setupHelperfn()
+}
+
+func setupHelperfn() {
+	helperfn["fn"] = func(g string) string { return "" }
+}
+
+var basefn = template.FuncMap{"fn": func(g string) string { return "" }}
+
+var copiedbasefn = template.FuncMap{}
+
+func init() {
+	for k, v := range basefn {
+		copiedbasefn[k] = v
+	}
+}
+
+var prefixedfn = template.FuncMap{
+	"fn":         func(g string) string { return "" },
+	"dupfn_fn":   func(g string) string { return "" },
+	"a_dupfn_fn": func(g string) string { return "" },
+}
+
+var dupfn = template.FuncMap{"fn": func(g int) int { return 0 }}
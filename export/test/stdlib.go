@@ -0,0 +1,9 @@
+package a
+
+import (
+	"strings"
+)
+
+var stdlibfn = map[string]interface{}{
+	"upper": strings.ToUpper,
+}
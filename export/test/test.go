@@ -2,8 +2,13 @@ package a
 
 import (
 	notbytes "bytes"
+	"fmt"
 	"html/template"
+	"maps"
+	"slices"
 	text "text/template"
+
+	"github.com/mh-cbon/export-funcmap/test/b"
 )
 
 var stringfn = map[string]interface{}{
@@ -114,9 +119,178 @@ var funcMap = text.FuncMap{
 	"_html_template_attrescaper": func() {},
 }
 
+func funcMapFn() text.FuncMap {
+	m := text.FuncMap{}
+	m["fn"] = func(g string) string { return "" }
+	return m
+}
+
+var callfn = funcMapFn()
+
+var initfn = map[string]interface{}{}
+
+func init() {
+	initfn["fn"] = func(g string) string { return "" }
+	initfn["removed"] = func(g string) string { return "" }
+	delete(initfn, "removed")
+}
+
+var mergedfn = merged()
+
+func merged() map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range otherstringfn {
+		ret[k] = v
+	}
+	for k, v := range stringfn {
+		ret[k] = v
+	}
+	return ret
+}
+
+var copiedfn = template.FuncMap{}
+
+func init() {
+	maps.Copy(copiedfn, stringfn)
+}
+
+var runefn = map[string]interface{}{
+	"fn": func(g rune) rune { return 0 },
+}
+var uintptrfn = map[string]interface{}{
+	"fn": func(g uintptr) uintptr { return 0 },
+}
+var complex64fn = map[string]interface{}{
+	"fn": func(g complex64) complex64 { return 0 },
+}
+var complex128fn = map[string]interface{}{
+	"fn": func(g complex128) complex128 { return 0 },
+}
+var arrayfn = map[string]interface{}{
+	"fn": func(g [2]string) [2]string { return [2]string{} },
+}
+var chanfn = map[string]interface{}{
+	"fn": func(g chan string, r <-chan int) chan<- bool { return nil },
+}
+var funcTypefn = map[string]interface{}{
+	"fn": func(g func(string, ...int) error) func() (string, error) { return nil },
+}
+var structLitfn = map[string]interface{}{
+	"fn": func(g struct {
+		A string `json:"a"`
+	}) struct{ B int } {
+		return struct{ B int }{}
+	},
+}
+var interfaceMethodsfn = map[string]interface{}{
+	"fn": func(g interface{ String() string }) interface {
+		fmt.Stringer
+		Name() string
+	} {
+		return nil
+	},
+}
+var namedSlicefn = map[string]interface{}{
+	"fn": func(g SomeSlice) SomeMap { return nil },
+}
+var namedFuncfn = map[string]interface{}{
+	"fn": func(g SomeFunc) SomePointer { return nil },
+}
+var namedArrayfn = map[string]interface{}{
+	"fn": func(g SomeArray) SomeArray { return SomeArray{} },
+}
+
+var someFuncValue func(string) string
+
+var funcValuefn = map[string]interface{}{
+	"fn": someFuncValue,
+}
+
+var unexportedStructfn = map[string]interface{}{
+	"fn": func(g string) unexportedNamer { return unexportedNamer{} },
+	"ok": func(g string) string { return "" },
+}
+
+var templatesfn = map[string]interface{}{
+	"fn": func(g template.HTML) *text.Template { return nil },
+}
+
+var genericfn = map[string]interface{}{
+	"keys":     maps.Keys[map[string]int],
+	"contains": slices.Contains[[]string],
+	"pair":     MakePair[string, SomeStruct],
+}
+
+// FnNameUpper is a funcmap key.
+const FnNameUpper = "upper"
+
+const prefix = "str_"
+
+var constkeyfn = map[string]interface{}{
+	FnNameUpper:          func(g string) string { return "" },
+	prefix + FnNameUpper: func(g string) string { return "" },
+	b.SomeKey:            func(g string) string { return "" },
+}
+
+func init() {
+	constkeyfn[prefix+"lower"] = func(g string) string { return "" }
+}
+
 // SomeStruct with a comment.
 type SomeStruct struct{}
 
 // SomeInterface with a comment.
 type SomeInterface interface{}
 type unexportedType interface{}
+
+// SomeSlice is a named slice.
+type SomeSlice []string
+
+// SomeMap is a named map.
+type SomeMap map[string]int
+
+// SomeFunc is a named func.
+type SomeFunc func(string) string
+
+// SomePointer is a named pointer.
+type SomePointer *SomeStruct
+
+// SomeArray is a named array.
+type SomeArray [4]byte
+
+// Pair is a generic struct.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// MakePair is a generic function.
+func MakePair[K comparable, V any](k K, v V) Pair[K, V] {
+	return Pair[K, V]{Key: k, Value: v}
+}
+
+// Namer is implemented by unexportedNamer.
+type Namer interface {
+	Name() string
+}
+
+type unexportedNamer struct {
+	Value string
+}
+
+func (u unexportedNamer) Name() string { return u.Value }
+
+var someFuncMaps = map[string]map[string]interface{}{}
+
+var unsupportedExprfn = someFuncMaps["x"]
+
+var notFuncfn = map[string]interface{}{
+	"fn": 1,
+}
+
+// NewNamer returns an unexported type.
+func NewNamer(v string) unexportedNamer { return unexportedNamer{Value: v} }
+
+var publicUnexportedfn = map[string]interface{}{
+	"namer": NewNamer,
+}
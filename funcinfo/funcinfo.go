@@ -0,0 +1,32 @@
+// Package funcinfo defines the public identifiers
+// declared by the files export-funcmap generates.
+package funcinfo
+
+// FuncInfo describes a function of a funcmap
+// that is declared at the package level.
+type FuncInfo struct {
+	// FuncName is the key of the function in the funcmap.
+	FuncName string
+	// Sel is the selector of the function, such as template.HTMLEscaper.
+	Sel string
+	// Pkg is the import path of the package declaring the function.
+	Pkg string
+	// PkgName is the name of the package declaring the function.
+	PkgName string
+	// Signature is the signature of the function,
+	// such as func(args ...interface{}) string.
+	Signature string
+	// Pos is the position of the function declaration,
+	// such as text/template/funcs.go:755.
+	Pos string
+}
+
+// Find returns the info of the function of given funcmap key.
+func Find(infos []FuncInfo, funcName string) (FuncInfo, bool) {
+	for _, info := range infos {
+		if info.FuncName == funcName {
+			return info, true
+		}
+	}
+	return FuncInfo{}, false
+}
@@ -0,0 +1,354 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mh-cbon/export-funcmap/export"
+)
+
+// Completion returns the functions whose name starts with the word
+// being typed at pos, within an action of text.
+func (s *Server) Completion(text string, pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	offset := offsetOf(text, pos)
+	action, ok := s.actionAt(text, offset)
+	if !ok {
+		return items
+	}
+	start, _ := identAt(text, offset)
+	if start < action || !callable(text, action, start) {
+		return items
+	}
+	prefix := text[start:offset]
+
+	var names []string
+	for name := range s.Checker.Funcs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := s.Checker.Funcs[name]
+		items = append(items, CompletionItem{
+			Label:         name,
+			Kind:          completionKindFunction,
+			Detail:        signature(fn).label,
+			Documentation: documentation(fn),
+		})
+	}
+	return items
+}
+
+// SignatureHelp returns the signature of the function called
+// by the command at pos, the active parameter is the argument at pos.
+// It returns nil when pos is not within the call of a known function.
+func (s *Server) SignatureHelp(text string, pos Position) *SignatureHelp {
+	offset := offsetOf(text, pos)
+	action, ok := s.actionAt(text, offset)
+	if !ok {
+		return nil
+	}
+	words := commandAt(text[action:offset])
+	if len(words) == 0 {
+		return nil
+	}
+	fn, ok := s.Checker.Funcs[words[0]]
+	if !ok || len(fn.Params) == 0 {
+		return nil
+	}
+	// the argument being typed, or the next one after a space.
+	active := len(words) - 2
+	if strings.HasSuffix(text[action:offset], " ") || strings.HasSuffix(text[action:offset], "\t") {
+		active++
+	}
+	if active < 0 {
+		active = 0
+	}
+	if active >= len(fn.Params) {
+		if !fn.Variadic {
+			return nil
+		}
+		active = len(fn.Params) - 1
+	}
+
+	sig := signature(fn)
+	info := SignatureInformation{Label: sig.label, Documentation: documentation(fn), Parameters: []ParameterInformation{}}
+	for _, p := range sig.params {
+		info.Parameters = append(info.Parameters, ParameterInformation{Label: p})
+	}
+	return &SignatureHelp{Signatures: []SignatureInformation{info}, ActiveParameter: active}
+}
+
+// Hover returns the signature, the doc comment and the origin
+// of the function under pos, it returns nil when there is none.
+func (s *Server) Hover(text string, pos Position) *Hover {
+	fn, start, end, ok := s.funcAt(text, pos)
+	if !ok {
+		return nil
+	}
+	value := "```go\n" + signature(fn).decl + "\n```"
+	if fn.Doc != "" {
+		value += "\n\n" + strings.TrimSpace(fn.Doc)
+	}
+	if fn.Sel != "" {
+		value += "\n\n`" + fn.Sel + "` of `" + fn.Pkg + "`, in `" + fn.Funcmap + "`"
+	} else {
+		value += "\n\nin `" + fn.Funcmap + "`"
+	}
+	r := Range{Start: positionOf(text, start), End: positionOf(text, end)}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// Definition returns the location of the declaration of the function
+// under pos, as recorded by PublicIdents for the functions declared
+// at the package level, the location of the func literal otherwise.
+// It returns nil when there is none.
+func (s *Server) Definition(text string, pos Position) *Location {
+	fn, _, _, ok := s.funcAt(text, pos)
+	if !ok || fn.Decl.Filename == "" {
+		return nil
+	}
+	// the columns of go positions count bytes,
+	// they are the characters of the ascii names of go declarations.
+	p := Position{Line: fn.Decl.Line - 1, Character: fn.Decl.Column - 1}
+	return &Location{URI: pathToURI(fn.Decl.Filename), Range: Range{Start: p, End: p}}
+}
+
+// parseErrorLine reads the line of the errors of text/template/parse,
+// such as template: index.tmpl:3: unexpected "}" in operand.
+var parseErrorLine = regexp.MustCompile(`^template: .*?:(\d+): (.*)$`)
+
+// Diagnostics returns the problems of the template text of filename,
+// a template that does not parse has a diagnostic of its parse error.
+func (s *Server) Diagnostics(filename, text string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	problems, err := s.Checker.Check(filename, text)
+	if err != nil {
+		d := Diagnostic{Severity: severityError, Source: "export-funcmap", Message: err.Error()}
+		if m := parseErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			d.Range.Start.Line = line - 1
+			d.Range.End = positionOf(text, lineOffset(text, line, 1)+lineLen(text, line))
+			d.Message = m[2]
+		}
+		return append(diagnostics, d)
+	}
+	for _, p := range problems {
+		start := lineOffset(text, p.Pos.Line, p.Pos.Column)
+		end := start + lineLen(text[start:], 1)
+		if p.Func != "" && strings.HasPrefix(text[start:], p.Func) {
+			end = start + len(p.Func)
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: positionOf(text, start), End: positionOf(text, end)},
+			Severity: severityError,
+			Source:   "export-funcmap",
+			Message:  p.Msg,
+		})
+	}
+	return diagnostics
+}
+
+// lineLen returns the length in bytes of the 1-based line of text.
+func lineLen(text string, line int) int {
+	start := lineOffset(text, line, 1)
+	if i := strings.IndexByte(text[start:], '\n'); i >= 0 {
+		return i
+	}
+	return len(text) - start
+}
+
+// actionAt returns the offset of the start of the action of text
+// around offset, after its left delimiter and trim marker.
+// Comments and closed actions are not actions.
+func (s *Server) actionAt(text string, offset int) (int, bool) {
+	left, right := s.Checker.LeftDelim, s.Checker.RightDelim
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	before := text[:offset]
+	start := strings.LastIndex(before, left)
+	if start < 0 || strings.Contains(before[start:], right) {
+		return 0, false
+	}
+	start += len(left)
+	if strings.HasPrefix(before[start:], "- ") {
+		start += 2
+	}
+	if strings.HasPrefix(strings.TrimLeft(before[start:], " \t\r\n"), "/*") {
+		return 0, false
+	}
+	return start, true
+}
+
+// funcAt returns the known function whose name is under pos,
+// with the offsets of the name.
+func (s *Server) funcAt(text string, pos Position) (fn export.Func, start, end int, ok bool) {
+	offset := offsetOf(text, pos)
+	action, ok := s.actionAt(text, offset)
+	if !ok {
+		return fn, 0, 0, false
+	}
+	start, end = identAt(text, offset)
+	if start == end || start < action || !callable(text, action, start) {
+		return fn, 0, 0, false
+	}
+	fn, ok = s.Checker.Funcs[text[start:end]]
+	return fn, start, end, ok
+}
+
+// identAt returns the offsets of the identifier around offset.
+func identAt(text string, offset int) (start, end int) {
+	start, end = offset, offset
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c >= 0x80
+}
+
+// callable tells if the identifier at start of an action can name
+// a function, it is not a field, a variable, a number or in a string.
+func callable(text string, action, start int) bool {
+	if start < len(text) && '0' <= text[start] && text[start] <= '9' {
+		return false
+	}
+	if start > action && (text[start-1] == '.' || text[start-1] == '$') {
+		return false
+	}
+	_, quoted := scanAction(text[action:start])
+	return !quoted
+}
+
+// commandAt returns the words of the innermost command
+// at the end of action, the text of an action up to a position.
+// A parenthesized pipeline is a single word.
+func commandAt(action string) []string {
+	starts, quoted := scanAction(action)
+	if quoted {
+		return nil
+	}
+	cmd := action[starts[len(starts)-1]:]
+
+	var words []string
+	depth, word := 0, -1
+	var quote byte
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '`' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+		space := c == ' ' || c == '\t' || c == '\r' || c == '\n'
+		if space && depth == 0 && word >= 0 {
+			words = append(words, cmd[word:i])
+			word = -1
+		} else if !space && word < 0 {
+			word = i
+		}
+	}
+	if word >= 0 {
+		words = append(words, cmd[word:])
+	}
+	return words
+}
+
+// scanAction returns the offsets of the starts of the commands
+// that are still open at the end of action, the innermost last,
+// and tells if the end of action is within a quoted string.
+func scanAction(action string) (starts []int, quoted bool) {
+	starts = []int{0}
+	var quote byte
+	for i := 0; i < len(action); i++ {
+		c := action[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '`', '\'':
+			quote = c
+		case '(':
+			starts = append(starts, i+1)
+		case ')':
+			if len(starts) > 1 {
+				starts = starts[:len(starts)-1]
+			}
+		case '|':
+			starts[len(starts)-1] = i + 1
+		}
+	}
+	return starts, quote != 0
+}
+
+// funcSignature is the text of the signature of a function.
+type funcSignature struct {
+	// label is name(params) results, decl is func label.
+	label string
+	decl  string
+	// params are the parameters, as written in label.
+	params []string
+}
+
+// signature returns the signature of fn, its unnamed parameters
+// are named arg0, arg1..., as the symbolic funcmap does.
+func signature(fn export.Func) funcSignature {
+	sig := funcSignature{}
+	for i, p := range fn.Params {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%v", i)
+		}
+		sig.params = append(sig.params, name+" "+p.Type)
+	}
+	var results []string
+	for _, r := range fn.Results {
+		results = append(results, strings.TrimSpace(r.Name+" "+r.Type))
+	}
+	sig.label = fn.Name + "(" + strings.Join(sig.params, ", ") + ")"
+	switch {
+	case len(results) == 1 && fn.Results[0].Name == "":
+		sig.label += " " + results[0]
+	case len(results) > 0:
+		sig.label += " (" + strings.Join(results, ", ") + ")"
+	}
+	sig.decl = "func " + sig.label
+	return sig
+}
+
+// documentation returns the doc comment of fn, nil when it has none.
+func documentation(fn export.Func) *MarkupContent {
+	if fn.Doc == "" {
+		return nil
+	}
+	return &MarkupContent{Kind: "markdown", Value: strings.TrimSpace(fn.Doc)}
+}
@@ -0,0 +1,175 @@
+// Package lsp is a language server of go templates,
+// powered by the symbolic version of their funcmaps.
+//
+// It completes the function names, helps with the signature
+// of the function being called, shows the doc comments of the functions
+// on hover, and goes to their definition.
+// The problems found by check are published as diagnostics.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mh-cbon/export-funcmap/check"
+)
+
+// Server serves the language server protocol over a stream,
+// the funcmaps are loaded once, when the server is created.
+type Server struct {
+	// Checker knows the functions of the funcmaps,
+	// the delimiters and the type of the data of the templates.
+	Checker *check.Checker
+
+	out  io.Writer
+	docs map[string]string
+	// shutdown tells a shutdown request was received,
+	// the exit notification then ends Serve without error.
+	shutdown bool
+}
+
+// NewServer returns a server of the functions of checker.
+func NewServer(checker *check.Checker) *Server {
+	return &Server{Checker: checker, docs: map[string]string{}}
+}
+
+// errExit ends Serve on the exit notification.
+var errExit = errors.New("exit")
+
+// Serve reads the messages of the client from r
+// and writes the responses to w, such as stdin and stdout.
+// It returns when the client exits or closes r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	in := bufio.NewReader(r)
+	for {
+		m, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		} else if err != nil && m == nil {
+			return err
+		}
+		if err != nil {
+			if err := s.replyError(m.ID, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.handle(m); err == errExit {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a message, it replies to requests,
+// notifications do not have replies.
+func (s *Server) handle(m *message) error {
+	var result interface{}
+	var err error
+	switch m.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// the documents are synchronized in full.
+				"textDocumentSync":   1,
+				"completionProvider": map[string]interface{}{},
+				"signatureHelpProvider": map[string]interface{}{
+					"triggerCharacters": []string{" ", "("},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "export-funcmap"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "exit":
+		return errExit
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			s.docs[p.TextDocument.URI] = p.TextDocument.Text
+			return s.publishDiagnostics(p.TextDocument.URI)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err = json.Unmarshal(m.Params, &p); err == nil && len(p.ContentChanges) > 0 {
+			s.docs[p.TextDocument.URI] = p.ContentChanges[len(p.ContentChanges)-1].Text
+			return s.publishDiagnostics(p.TextDocument.URI)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			delete(s.docs, p.TextDocument.URI)
+			return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/completion":
+		var p positionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			result = s.Completion(s.docs[p.TextDocument.URI], p.Position)
+		}
+	case "textDocument/signatureHelp":
+		var p positionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			if help := s.SignatureHelp(s.docs[p.TextDocument.URI], p.Position); help != nil {
+				result = help
+			}
+		}
+	case "textDocument/hover":
+		var p positionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			if hover := s.Hover(s.docs[p.TextDocument.URI], p.Position); hover != nil {
+				result = hover
+			}
+		}
+	case "textDocument/definition":
+		var p positionParams
+		if err = json.Unmarshal(m.Params, &p); err == nil {
+			if loc := s.Definition(s.docs[p.TextDocument.URI], p.Position); loc != nil {
+				result = loc
+			}
+		}
+	default:
+		if m.ID == nil {
+			// unknown notifications, such as initialized, are ignored.
+			return nil
+		}
+		return s.replyError(m.ID, codeMethodNotFound, "method not found: "+m.Method)
+	}
+	if m.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.replyError(m.ID, codeInvalidParams, err.Error())
+	}
+	return s.write(response{JSONRPC: "2.0", ID: m.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) error {
+	if id == nil {
+		return nil
+	}
+	return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(m interface{}) error {
+	return writeMessage(s.out, m)
+}
+
+// publishDiagnostics publishes the problems of the document of uri.
+func (s *Server) publishDiagnostics(uri string) error {
+	diagnostics := s.Diagnostics(uriToPath(uri), s.docs[uri])
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
@@ -0,0 +1,212 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mh-cbon/export-funcmap/check"
+	"github.com/mh-cbon/export-funcmap/export"
+	"github.com/mh-cbon/export-funcmap/lsp"
+)
+
+func newServer(t *testing.T) *lsp.Server {
+	export.EnableCache = false
+	targets := export.Targets{}
+	args := []string{"@text/template", "github.com/mh-cbon/export-funcmap/export/test:stdlibfn"}
+	if err := targets.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := export.Config{}.Describe(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lsp.NewServer(check.New(desc))
+}
+
+// at returns the position of the n-th character of the first line.
+func at(n int) lsp.Position {
+	return lsp.Position{Line: 0, Character: n}
+}
+
+func TestFeatures(t *testing.T) {
+	s := newServer(t)
+
+	text := `{{ pri }} {{ .pri }} pri`
+	var labels []string
+	for _, item := range s.Completion(text, at(6)) {
+		labels = append(labels, item.Label)
+	}
+	if got := strings.Join(labels, " "); got != "print printf println" {
+		t.Errorf("Invalid completion, got %q", got)
+	}
+	if got := s.Completion(text, at(17)); len(got) != 0 {
+		t.Errorf("Invalid completion of a field, got %v", got)
+	}
+	if got := s.Completion(text, at(24)); len(got) != 0 {
+		t.Errorf("Invalid completion out of an action, got %v", got)
+	}
+
+	text = `{{ slice "abc" 1 (len "a") }}`
+	help := s.SignatureHelp(text, at(15))
+	if help == nil {
+		t.Fatal("Missing signature help of slice")
+	}
+	sig := help.Signatures[0]
+	if sig.Label != "slice(item interface{}, indexes ...interface{}) (interface{}, error)" {
+		t.Errorf("Invalid signature label, got %q", sig.Label)
+	}
+	if len(sig.Parameters) != 2 || sig.Parameters[0].Label != "item interface{}" {
+		t.Errorf("Invalid signature parameters, got %v", sig.Parameters)
+	}
+	if help.ActiveParameter != 1 {
+		t.Errorf("Invalid active parameter, want 1, got %v", help.ActiveParameter)
+	}
+	help = s.SignatureHelp(text, at(22))
+	if help == nil || help.Signatures[0].Label != "len(item interface{}) (int, error)" || help.ActiveParameter != 0 {
+		t.Errorf("Invalid signature help within parentheses, got %v", help)
+	}
+
+	text = `{{ "a" | and true }}`
+	hover := s.Hover(text, at(10))
+	if hover == nil {
+		t.Fatal("Missing hover of and")
+	}
+	if !strings.HasPrefix(hover.Contents.Value, "```go\nfunc and(arg0 interface{}, args ...interface{}) interface{}\n```\n\nand computes the Boolean AND") {
+		t.Errorf("Invalid hover, got %q", hover.Contents.Value)
+	}
+	if !strings.HasSuffix(hover.Contents.Value, "last argument.\n\nin `text/template:builtins`") {
+		t.Errorf("Invalid hover origin, got %q", hover.Contents.Value)
+	}
+	if hover.Range.Start != at(9) || hover.Range.End != at(12) {
+		t.Errorf("Invalid hover range, got %v", hover.Range)
+	}
+	if got := s.Hover(text, at(4)); got != nil {
+		t.Errorf("Invalid hover of a string, got %v", got)
+	}
+
+	loc := s.Definition(text, at(10))
+	if loc == nil {
+		t.Fatal("Missing definition of and")
+	}
+	if !strings.HasPrefix(loc.URI, "file:///") || !strings.HasSuffix(loc.URI, "/text/template/funcs.go") {
+		t.Errorf("Invalid definition uri, got %v", loc.URI)
+	}
+	if loc.Range.Start.Line == 0 || loc.Range.Start.Character != 5 {
+		t.Errorf("Invalid definition range, got %v", loc.Range)
+	}
+
+	// the declaration of a dependency is in the source of its package.
+	text = `{{ upper "a" }}`
+	loc = s.Definition(text, at(4))
+	if loc == nil {
+		t.Fatal("Missing definition of upper")
+	}
+	if strings.Contains(loc.URI, "GOROOT") || !strings.HasPrefix(loc.URI, "file:///") || !strings.HasSuffix(loc.URI, "/strings/strings.go") {
+		t.Errorf("Invalid definition uri, got %v", loc.URI)
+	}
+	if loc.Range.Start.Line == 0 || loc.Range.Start.Character != 5 {
+		t.Errorf("Invalid definition range, got %v", loc.Range)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	s := newServer(t)
+
+	text := "héllo\n{{ len 1 2 }}\n{{ nope }}"
+	got := s.Diagnostics("index.tmpl", text)
+	if len(got) != 2 {
+		t.Fatalf("Invalid diagnostics, got %v", got)
+	}
+	if got[0].Range.Start.Line != 1 || got[0].Range.Start.Character != 3 || got[0].Range.End.Character != 6 {
+		t.Errorf("Invalid range of %v", got[0])
+	}
+	if got[0].Message != `too many arguments for "len": want 1, got 2, it is not variadic` {
+		t.Errorf("Invalid message, got %q", got[0].Message)
+	}
+	if got[1].Message != `unknown function "nope"` {
+		t.Errorf("Invalid message, got %q", got[1].Message)
+	}
+
+	got = s.Diagnostics("index.tmpl", "a\n{{ if }}")
+	if len(got) != 1 || got[0].Range.Start.Line != 1 || got[0].Message != "missing value for if" {
+		t.Errorf("Invalid diagnostics of a parse error, got %v", got)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := newServer(t)
+
+	uri := "file://" + filepath.ToSlash(filepath.Join(t.TempDir(), "index.tmpl"))
+	var in bytes.Buffer
+	send := func(m string) {
+		fmt.Fprintf(&in, "Content-Length: %v\r\n\r\n%v", len(m), m)
+	}
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	send(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)
+	send(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","text":"{{ nope }}"}}}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":"` + uri + `"},"position":{"line":0,"character":3}}}`)
+	send(`{"jsonrpc":"2.0","id":3,"method":"unknown/method"}`)
+	send(`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+
+	var out bytes.Buffer
+	if err := s.Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]interface{}
+	r := bufio.NewReader(&out)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ReadString('\n')
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("Invalid number of messages, want 5, got %v: %v", len(got), got)
+	}
+	caps, _ := got[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	if caps["hoverProvider"] != true || caps["definitionProvider"] != true {
+		t.Errorf("Invalid capabilities, got %v", caps)
+	}
+	if got[1]["method"] != "textDocument/publishDiagnostics" {
+		t.Errorf("Invalid notification, got %v", got[1])
+	}
+	diagnostics := got[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Errorf("Invalid diagnostics, got %v", diagnostics)
+	}
+	if res, ok := got[2]["result"]; !ok || res != nil {
+		t.Errorf("Invalid hover of an unknown function, got %v", got[2])
+	}
+	if e, _ := got[3]["error"].(map[string]interface{}); e == nil || e["code"] != float64(-32601) {
+		t.Errorf("Invalid error of an unknown method, got %v", got[3])
+	}
+	if res, ok := got[4]["result"]; !ok || res != nil {
+		t.Errorf("Invalid shutdown response, got %v", got[4])
+	}
+}
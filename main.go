@@ -1,20 +1,44 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/mh-cbon/export-funcmap/check"
 	"github.com/mh-cbon/export-funcmap/export"
+	"github.com/mh-cbon/export-funcmap/lsp"
 )
 
 var version = "0.0.0"
 
+// exit codes, they let scripts tell the failures apart.
+const (
+	exitError           = 1
+	exitUsage           = 2
+	exitTargetNotFound  = 3
+	exitUnsupportedType = 4
+	exitUnsupportedExpr = 5
+	exitStale           = 6
+	exitKeyConflict     = 7
+	exitCheckProblems   = 8
+)
+
 func main() {
 
 	var help = flag.Bool("help", false, "Show help")
 	var shelp = flag.Bool("h", false, "Show help")
 	var sver = flag.Bool("v", false, "Show version")
+	var tags = flag.String("tags", "", "Build tags used to load the packages")
+	var split = flag.Bool("split", false, "Export each funcmap into its own variable")
+	var unexported = flag.String("unexported", "error", "How to export unexported types")
+	var merge = flag.String("merge", "last", "How to merge a key set by several funcmaps")
+	var format = flag.String("format", "go", "Output format, go or json")
+	var check = flag.Bool("check", false, "Check that outfilename is up to date")
+	var config = flag.String("config", "", "A jobs file of exports to run")
 
 	flag.Parse()
 
@@ -26,21 +50,65 @@ func main() {
 		return
 	}
 
-	args := os.Args[1:]
+	args := flag.Args()
 
 	// small trick for go run,
 	// it needs -- to separate arguments for go run and the runned program
 	// but for the final built executable it does not exists.
 	// lets detect it and remove it.
-	if args[0] == "--" {
+	if len(args) > 0 && args[0] == "--" {
 		args = args[1:]
 	}
 
-	if len(args) < 4 {
-		showHelp()
-		fmt.Println()
-		fmt.Println("Not enough arguments.")
+	if len(args) > 0 && args[0] == "check" {
+		runCheck(args[1:])
+		return
+	} else if len(args) > 0 && args[0] == "unused" {
+		runUnused(args[1:])
+		return
+	} else if len(args) > 0 && args[0] == "lsp" {
+		runLSP(args[1:])
+		return
+	}
+
+	if *config != "" {
+		// the jobs file sets the options of its exports.
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name != "config" && f.Name != "check" {
+				usage(fmt.Sprintf("-%v can not be used with -config, set it in the jobs file", f.Name))
+			}
+		})
+		if len(args) > 0 {
+			usage(fmt.Sprintf("Unexpected arguments %v, the jobs file sets the targets", strings.Join(args, " ")))
+		}
+		runJobs(*config, *check)
+		return
+	}
+
+	policy, err := export.ParseUnexportedPolicy(*unexported)
+	if err != nil {
+		usage(err)
+	}
+
+	mergePolicy, err := export.ParseMergePolicy(*merge)
+	if err != nil {
+		usage(err)
+	}
+
+	conf := export.Config{Split: *split, Unexported: policy, Merge: mergePolicy}
+	if *tags != "" {
+		conf.BuildFlags = append(conf.BuildFlags, "-tags="+*tags)
+	}
+
+	if *format == "json" {
+		describe(args, conf)
 		return
+	} else if *format != "go" {
+		usage("Unknown format " + *format)
+	}
+
+	if len(args) < 4 {
+		usage("Not enough arguments.")
 	}
 	outfilename := args[0]
 	outpackage := args[1]
@@ -48,19 +116,276 @@ func main() {
 
 	targets := export.Targets{}
 	if err := targets.Parse(args[3:]); err != nil {
-		showHelp()
-		fmt.Println()
-		fmt.Println(err)
-		return
+		usage(err)
 	}
 
-	destFile, err := export.Export(targets, outfilename, outpackage, outvarname)
+	res, err := conf.Export(targets, outfilename, outpackage, outvarname)
 	if err != nil {
-		panic(err)
+		fail(err)
+	}
+
+	if !output(outfilename, res, *check) {
+		os.Exit(exitStale)
+	}
+}
+
+// output writes the result of an export to outfilename,
+// or compares it to outfilename when check is true.
+// It returns false when the checked file is not up to date.
+func output(outfilename string, res *export.Result, check bool) bool {
+
+	// report the exported variables.
+	for _, v := range res.Vars {
+		fmt.Fprintln(os.Stderr, "exported", v)
+	}
+	for _, w := range res.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
 	}
+	for _, c := range res.Conflicts {
+		fmt.Fprintln(os.Stderr, "conflict:", c)
+	}
+
+	// compare the result to the file already generated.
+	if check {
+		diff, err := export.Verify(outfilename, res.File)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Print(diff)
+		return diff == ""
+	}
+
+	// write the result, - prints it.
+	if outfilename == "-" {
+		src, err := export.Format(outfilename, res.File)
+		if err != nil {
+			fail(err)
+		}
+		if _, err := os.Stdout.Write(src); err != nil {
+			fail(err)
+		}
+		return true
+	}
+	if err := export.WriteFile(outfilename, res.File); err != nil {
+		fail(err)
+	}
+	return true
+}
+
+// runJobs runs the exports of a jobs file.
+func runJobs(filename string, check bool) {
+	jobs, err := export.LoadJobs(filename)
+	if err != nil {
+		fail(err)
+	}
+
+	results, err := jobs.Export()
+	if err != nil {
+		fail(err)
+	}
+
+	upToDate := true
+	for i, res := range results {
+		upToDate = output(jobs.Jobs[i].Out, res, check) && upToDate
+	}
+	if !upToDate {
+		os.Exit(exitStale)
+	}
+}
+
+// describe prints the JSON description of the funcmaps of targets.
+func describe(args []string, conf export.Config) {
+	if len(args) < 1 {
+		usage("Not enough arguments.")
+	}
+
+	targets := export.Targets{}
+	if err := targets.Parse(args); err != nil {
+		usage(err)
+	}
+
+	desc, err := conf.Describe(targets)
+	if err != nil {
+		fail(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(desc); err != nil {
+		fail(err)
+	}
+}
+
+// stringsFlag is a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, " ")
+}
 
-	// print the result.
-	export.PrintAstFile(os.Stdout, destFile)
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// templateFlags are the flags of the commands analyzing templates.
+type templateFlags struct {
+	set    *flag.FlagSet
+	funcs  stringsFlag
+	tags   *string
+	delims *string
+	data   *string
+}
+
+func newTemplateFlags(name string) *templateFlags {
+	f := &templateFlags{set: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.set.Usage = func() {}
+	f.set.Var(&f.funcs, "funcs", "A funcmap the templates can call, repeatable")
+	f.tags = f.set.String("tags", "", "Build tags used to load the packages")
+	f.delims = f.set.String("delims", "", "The action delimiters, such as \"[[ ]]\"")
+	f.data = f.set.String("data", "", "The type of the data of the templates, as pkgpath.Type")
+	return f
+}
+
+// checker parses args and returns the checker of the funcmaps,
+// the builtin funcs of text/template are always known.
+// args must have at least minArgs arguments after the flags.
+func (f *templateFlags) checker(args []string, minArgs int) *check.Checker {
+	if err := f.set.Parse(args); err != nil {
+		usage(err)
+	}
+	if f.set.NArg() < minArgs {
+		usage("Not enough arguments.")
+	}
+
+	targets := export.Targets{}
+	if err := targets.Parse(append([]string{"@text/template"}, f.funcs...)); err != nil {
+		usage(err)
+	}
+	conf := export.Config{}
+	if *f.tags != "" {
+		conf.BuildFlags = append(conf.BuildFlags, "-tags="+*f.tags)
+	}
+	prog, err := export.GetProgram(targets.GetPackagePaths(), conf.BuildFlags...)
+	if err != nil {
+		fail(err)
+	}
+	conf.Prog = prog
+	desc, err := conf.Describe(targets)
+	if err != nil {
+		fail(err)
+	}
+
+	for _, w := range desc.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	checker := check.New(desc)
+	if *f.data != "" {
+		// the data package shares the program of the funcmaps.
+		checker.Data, err = check.DataType(prog, *f.data)
+		if err != nil {
+			fail(err)
+		}
+	}
+	if *f.delims != "" {
+		d := strings.Fields(*f.delims)
+		if len(d) != 2 {
+			usage("Invalid delimiters " + *f.delims)
+		}
+		checker.LeftDelim, checker.RightDelim = d[0], d[1]
+	}
+	return checker
+}
+
+// runCheck checks the function calls of templates.
+func runCheck(args []string) {
+	f := newTemplateFlags("check")
+	checker := f.checker(args, 1)
+
+	problems, err := checker.CheckFiles(f.set.Args()...)
+	if err != nil {
+		fail(err)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		os.Exit(exitCheckProblems)
+	}
+}
+
+// runUnused reports the funcmap functions the templates do not call,
+// the builtin funcs are reported only when they are given to -funcs.
+func runUnused(args []string) {
+	f := newTemplateFlags("unused")
+	var format = f.set.String("format", "text", "Output format, text or json")
+	checker := f.checker(args, 1)
+	if *format != "text" && *format != "json" {
+		usage("Unknown format " + *format)
+	}
+
+	report, err := checker.Usage(f.set.Args()...)
+	if err != nil {
+		fail(err)
+	}
+	builtins := false
+	for _, funcs := range f.funcs {
+		builtins = builtins || strings.HasPrefix(funcs, "@")
+	}
+	if !builtins {
+		report.Filter("text/template:builtins")
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// runLSP serves the language server of the templates over stdin and stdout,
+// the funcmaps are loaded from the working directory.
+func runLSP(args []string) {
+	f := newTemplateFlags("lsp")
+	checker := f.checker(args, 0)
+	if err := lsp.NewServer(checker).Serve(os.Stdin, os.Stdout); err != nil {
+		fail(err)
+	}
+}
+
+// usage shows the help and the reason of the usage error, then exits.
+func usage(reason interface{}) {
+	showHelp()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, reason)
+	os.Exit(exitUsage)
+}
+
+// fail prints the error and exits with the code of its kind.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+
+	var notFound *export.TargetNotFoundError
+	var unsupportedType *export.UnsupportedTypeError
+	var unsupportedExpr *export.UnsupportedExprError
+	var keyConflict *export.KeyConflictError
+	switch {
+	case errors.As(err, &notFound):
+		os.Exit(exitTargetNotFound)
+	case errors.As(err, &unsupportedType):
+		os.Exit(exitUnsupportedType)
+	case errors.As(err, &unsupportedExpr):
+		os.Exit(exitUnsupportedExpr)
+	case errors.As(err, &keyConflict):
+		os.Exit(exitKeyConflict)
+	}
+	os.Exit(exitError)
 }
 
 func showHelp() {
@@ -69,10 +394,17 @@ Export a funcmap variable declaration to its symbolic version.
 
 Usage
 
-	export-funcmap <outfilename> <outpackage> <outvarname> <pkgpath:var...>....
+	export-funcmap [options] <outfilename> <outpackage> <outvarname> <pkgpath:var...>....
+	export-funcmap -format json [options] <pkgpath:var...>....
+	export-funcmap -config <file> [-check]
+	export-funcmap check [-funcs <pkgpath:var>]... [-data <pkgpath.Type>] [-delims "{{ }}"] [-tags tags] <file|dir|glob>...
+	export-funcmap unused [-format text|json] [-funcs <pkgpath:var>]... [-delims "{{ }}"] [-tags tags] <file|dir|glob>...
+	export-funcmap lsp [-funcs <pkgpath:var>]... [-data <pkgpath.Type>] [-delims "{{ }}"] [-tags tags]
 
 	outfilename
-		The output filepath of the export result.
+		The output filepath of the export result,
+		the file is written with a "Code generated" header.
+		Use - to print the result.
 		required.
 
 	outpackage
@@ -89,12 +421,170 @@ Usage
 		to export.
 		Each package path can be followed by multiple semi-colon variable if
 		multiple variable needs to be extracted from the same package.
+		A package path alone, or followed by :*, exports every
+		funcmap variable declared in the package,
+		the maps that are not funcmaps are skipped with a warning.
+		The variable can also be a function returning a funcmap,
+		keys assigned at init time are exported too,
+		as well as the funcmaps made with make or assigned at init time.
+		The init funcs, and the funcs they call, run at init time,
+		the assignments of the other funcs are ignored.
+		A funcmap variable never assigned is an error.
+		The target can be followed by comma separated options
+		to remap its keys,
+		  prefix=str_: add a prefix to the keys that are not renamed,
+		  rename=old=new: export the key old as new, repeatable,
+		  include=pattern: export only the keys matching the pattern, repeatable,
+		  exclude=pattern: leave the keys matching the pattern out, repeatable.
+		A pattern is a glob such as html*, or a regular expression
+		between slashes such as /^_/, it can not contain a comma.
+		Patterns apply to the keys before they are renamed.
+		Two keys of a funcmap remapped to the same key are an error,
+		renaming a key that does not exist is a warning.
+		The builtin funcs of the template packages of the installed go
+		are targeted with @text/template, and @html/template
+		which adds the escapers of html/template,
+		their reflect.Value parameters are exported as interface{}.
 		required.
 
+	-split
+		Export each funcmap variable into its own variable,
+		named after outvarname and the exported variable.
+
+	-check
+		Do not write outfilename, compare its signatures
+		and its public idents, but their positions, to the export result.
+		Print a diff of the added, removed and changed signatures,
+		and exit with status 6 when they differ, or when outfilename is missing.
+
+	-config
+		A jobs file of exports to run, in json, yaml or toml.
+		The packages of all jobs are loaded once.
+		Each job is given its out, package, var and targets,
+		and optionally split, unexported and merge, for example in yaml
+		  tags: prod
+		  jobs:
+		  - out: views/gen.go
+		    package: views
+		    var: funcs
+		    targets: [text/template:builtins]
+		Outputs are relative to the jobs file.
+		Only -check can be given with -config,
+		the other options and the arguments are set in the jobs file.
+
+	-format
+		The output format, one of
+		  go: print the symbolic funcmap as go source (default),
+		  json: print a description of the functions of the funcmaps,
+		        with their parameters, results, origin and position.
+		        It takes only the pkgpath:var arguments.
+
+	-unexported
+		How to export a signature using a type unexported in its package.
+		One of
+		  error: fail the export (default),
+		  interface: use the exported interface of its package it implements,
+		             or interface{},
+		  underlying: use its underlying type,
+		  any: use interface{},
+		  skip: skip the function with a warning.
+
+	-merge
+		How to merge a key set by several funcmaps
+		exported into the same variable, every conflict is reported.
+		Funcmaps setting the same value, such as a copied funcmap,
+		do not conflict.
+		One of
+		  last: keep the value of the last funcmap (default),
+		  first: keep the value of the first funcmap,
+		  error: fail the export,
+		  prefix: keep both, the next values are given a key prefixed
+		          by their variable name, such as k2_dup,
+		          then by their package name, then numbered, when it is taken.
+
+	-tags
+		A comma separated list of build tags to consider
+		when loading the packages.
+
+	check
+		Check the function calls of go templates against the symbolic funcmaps,
+		unknown functions, wrong numbers and types of arguments,
+		and printf verbs of the wrong type are reported
+		as file:line:col: problem.
+		The types flow through pipelines and variables,
+		the piped value is the last argument of a call.
+		Directories are walked for .tmpl and .html files,
+		glob patterns such as "views/*.tmpl" are expanded.
+		-funcs pkgpath:var
+			A funcmap the templates can call, repeatable,
+			the builtin funcs of @text/template are always known.
+		-data pkgpath.Type
+			The type of the data the templates are executed with,
+			such as github.com/acme/app/views.PageData, prefixed by * for a pointer.
+			The fields and methods of the dot and of $ are checked,
+			through range, with and the templates invoked.
+
+	unused
+		Report the functions of the funcmaps the templates never call,
+		and the call sites of those they call, for example
+		  unused	trim	github.com/acme/app/views:funcs
+		  used	upper	github.com/acme/app/views:funcs
+		  	views/index.tmpl:3:12
+		It takes the -funcs, -delims and -tags options of check,
+		the builtin funcs are reported when they are given to -funcs.
+		-format
+			The output format, text (default) or json.
+		-delims
+			The left and right action delimiters, space separated.
+
+	lsp
+		Serve the language server protocol over stdin and stdout,
+		for the editors of go templates.
+		It takes the -funcs, -data, -delims and -tags options of check,
+		the funcmaps are loaded once, from the working directory.
+		It provides
+		  the completion of the function names within actions,
+		  the signature help of the function being called,
+		  with the parameter names of the symbolic funcmap,
+		  the hover of the doc comments of the functions,
+		  the definition of the functions, their declaration
+		  for the functions declared at the package level,
+		  the diagnostics of check, as the documents change.
+
+	-v
+		Show version
+
+	-h|--help
+		Show help
+
+Exit status
+	0 success
+	1 failure, such as a package that does not load
+	2 invalid usage
+	3 a target variable is not found
+	4 a signature uses a type that can not be exported
+	5 a funcmap goes through an expression that can not be analyzed
+	6 the file checked with -check is not up to date
+	7 a key is set by several funcmaps with -merge error,
+	  or by two keys of a funcmap remapped to the same key
+	8 the templates checked with check have problems
+
 Example
 	export-funcmap gen.go gen export text/template:builtins
+	export-funcmap - gen export text/template:builtins
 	export-funcmap gen.go gen export text/template:builtins:builtins
 	export-funcmap gen.go gen export text/template:builtins text/template:builtins
+	export-funcmap -split gen.go gen export github.com/acme/app/views
+	export-funcmap -check gen.go gen export text/template:builtins
+	export-funcmap -config export-funcmap.yml
+	export-funcmap gen.go gen export github.com/acme/app/views:funcs,prefix=str_,rename=trim=strtrim,exclude=env
+	export-funcmap gen.go gen export html/template:funcMap,exclude=/^_/
+	export-funcmap -format json text/template:builtins
+	export-funcmap gen.go gen export @html/template github.com/acme/app/views:funcs
+	export-funcmap check -funcs github.com/acme/app/views:funcs views/
+	export-funcmap check -funcs github.com/acme/app/views:funcs -data github.com/acme/app/views.PageData views/
+	export-funcmap unused -format json -funcs github.com/acme/app/views:funcs "views/*.tmpl"
+	export-funcmap lsp -funcs github.com/acme/app/views:funcs -data github.com/acme/app/views.PageData
 `)
 }
 func showVersion() {
@@ -1,3 +1,6 @@
 package b
 
 type SomeType struct{}
+
+// SomeKey is a funcmap key.
+const SomeKey = "somekey"